@@ -8,6 +8,7 @@ import (
 	"databasus-checker/internal/utils"
 	"databasus-checker/internal/worker"
 	"flag"
+	"fmt"
 	"html/template"
 	"io"
 	"log"
@@ -15,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -39,8 +41,10 @@ func (t *TemplateRenderer) Render(w io.Writer, name string, data interface{}, c
 func (t *TemplateRenderer) RenderDashboard(w io.Writer, name string, data interface{}, activeMenu string) error {
 	layout := filepath.Join(t.templatesDir, "dashboard_layout.html")
 	view := filepath.Join(t.templatesDir, name)
+	// Bagian form yang dipakai bersama halaman create & edit test
+	partials := filepath.Join(t.templatesDir, "tests_partials.html")
 
-	tmpl, err := template.ParseFiles(layout, view)
+	tmpl, err := template.ParseFiles(layout, view, partials)
 	if err != nil {
 		return err
 	}
@@ -75,10 +79,22 @@ func main() {
 		return
 	}
 
+	// Start Reaper (bereskan job RUNNING yang ditinggal sebelum worker mulai)
+	reaper := worker.NewReaper()
+	reaper.Start()
+
 	// Start Worker
 	bgWorker := worker.NewWorker()
 	bgWorker.Start()
 
+	// Start Scheduler (Cron)
+	scheduler := worker.NewScheduler()
+	scheduler.Start()
+
+	// Start Backup Watcher (Auto-run saat ada backup baru)
+	backupWatcher := worker.NewBackupWatcher()
+	backupWatcher.Start()
+
 	e := echo.New()
 	e.Renderer = &TemplateRenderer{templatesDir: "web/templates"}
 	middleware.Setup(e)
@@ -132,16 +148,19 @@ func main() {
 
 	databasusClient := services.DatabasusClient{}
 	queueService := services.QueueService{}
+	scheduleService := services.ScheduleService{}
 
 	// Route Dashboard (Menampilkan History Log & Check Health)
 	e.GET("/", func(c echo.Context) error {
 		history, _ := queueService.GetJobHistory(20) // Get last 20 logs
+		stepStats, _ := queueService.GetStepStats(time.Now().AddDate(0, 0, -30))
 		
 		// NEW: Panggil fungsi CheckHealth dari DatabasusClient
 		isHealthy := databasusClient.CheckHealth()
 
 		return e.Renderer.(*TemplateRenderer).RenderDashboard(c.Response().Writer, "dashboard_index.html", echo.Map{
 			"History":   history,
+			"StepStats": stepStats,
 			"IsHealthy": isHealthy, // Kirim ke template
 		}, "dashboard")
 	})
@@ -162,6 +181,14 @@ func main() {
 		if retentionDays > 0 {
 			settings.LogRetentionDays = retentionDays
 		}
+		workerConcurrency, _ := strconv.Atoi(c.FormValue("worker_concurrency"))
+		if workerConcurrency > 0 {
+			settings.WorkerConcurrency = workerConcurrency
+		}
+		maxContainers, _ := strconv.Atoi(c.FormValue("max_containers"))
+		if maxContainers > 0 {
+			settings.MaxContainers = maxContainers
+		}
 		database.DB.Save(&settings)
 		return c.Redirect(http.StatusFound, "/settings")
 	})
@@ -173,13 +200,24 @@ func main() {
 	e.GET("/tests", func(c echo.Context) error {
 		var tests []models.RestoreTestConfig
 		database.DB.Order("created_at desc").Find(&tests)
+
+		// Tampilkan jadwal berikutnya sesuai timezone masing-masing test
+		for i := range tests {
+			if tests[i].NextRunAt != nil {
+				localNext := tests[i].NextRunAt.In(scheduleService.Location(tests[i].CronTimezone))
+				tests[i].NextRunAt = &localNext
+			}
+		}
 		return e.Renderer.(*TemplateRenderer).RenderDashboard(c.Response().Writer, "tests_list.html", echo.Map{"Tests": tests}, "tests")
 	})
 
 	e.GET("/tests/create", func(c echo.Context) error {
+		// Nilai awal form, sama dengan default kolom di model
+		defaults := models.RestoreTestConfig{RestoreTimeoutMinutes: 60, MaxAttempts: 1, RetryBackoffSeconds: 60}
+
 		workspaces, err := databasusClient.GetWorkspaces()
 		if err != nil {
-			return e.Renderer.(*TemplateRenderer).RenderDashboard(c.Response().Writer, "tests_form.html", echo.Map{"Error": "Could not fetch workspaces. Check settings."}, "tests")
+			return e.Renderer.(*TemplateRenderer).RenderDashboard(c.Response().Writer, "tests_form.html", echo.Map{"Error": "Could not fetch workspaces. Check settings.", "Test": defaults}, "tests")
 		}
 		var storages []models.StorageConfig
 		var notifications []models.NotificationConfig
@@ -187,6 +225,7 @@ func main() {
 		database.DB.Find(&notifications)
 
 		return e.Renderer.(*TemplateRenderer).RenderDashboard(c.Response().Writer, "tests_form.html", echo.Map{
+			"Test":          defaults,
 			"Workspaces":    workspaces,
 			"Storages":      storages,
 			"Notifications": notifications,
@@ -195,7 +234,7 @@ func main() {
 
 	e.GET("/api/proxy/databases", func(c echo.Context) error {
 		workspaceID := c.QueryParam("workspace_id")
-		dbs, err := databasusClient.GetDatabases(workspaceID)
+		dbs, err := databasusClient.GetDatabases(c.Request().Context(), workspaceID)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
@@ -206,13 +245,142 @@ func main() {
 	e.POST("/api/tests/:id/run", func(c echo.Context) error {
 		idParam := c.Param("id")
 		// ID sudah UUID, jangan convert ke int
-		_, err := queueService.Enqueue(idParam)
+		_, err := queueService.Enqueue(idParam, models.TriggerManual)
 		if err != nil {
 			return c.Redirect(http.StatusFound, "/tests?error="+err.Error())
 		}
 		return c.Redirect(http.StatusFound, "/tests?success=Test+queued+successfully")
 	})
 
+	// Timeout restore, target RTO & retry policy dari form
+	applyRunPolicy := func(c echo.Context, config *models.RestoreTestConfig) {
+		config.RestoreTimeoutMinutes, _ = strconv.Atoi(c.FormValue("restore_timeout_minutes"))
+		if config.RestoreTimeoutMinutes < 1 {
+			config.RestoreTimeoutMinutes = 60
+		}
+		config.RTOTargetMinutes, _ = strconv.Atoi(c.FormValue("rto_target_minutes"))
+		if config.RTOTargetMinutes < 0 {
+			config.RTOTargetMinutes = 0
+		}
+
+		config.MaxAttempts, _ = strconv.Atoi(c.FormValue("max_attempts"))
+		if config.MaxAttempts < 1 {
+			config.MaxAttempts = 1
+		}
+		config.RetryBackoffSeconds, _ = strconv.Atoi(c.FormValue("retry_backoff_seconds"))
+		if config.RetryBackoffSeconds < 1 {
+			config.RetryBackoffSeconds = 60
+		}
+	}
+
+	// Image, env, argumen & batas resource container dari form. Env (KEY=VALUE) dan argumen satu per baris
+	applyContainer := func(c echo.Context, config *models.RestoreTestConfig) error {
+		config.ContainerImage = strings.TrimSpace(c.FormValue("container_image"))
+
+		config.ContainerEnv = models.StringArray{}
+		for _, line := range strings.Split(c.FormValue("container_env"), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if !strings.Contains(line, "=") || strings.HasPrefix(line, "=") {
+				return fmt.Errorf("invalid container env %q, expected KEY=VALUE", line)
+			}
+			if key, _, _ := strings.Cut(line, "="); services.IsCredentialEnv(key) {
+				return fmt.Errorf("container env %s is managed by the checker (database credentials) and cannot be overridden", key)
+			}
+			config.ContainerEnv = append(config.ContainerEnv, line)
+		}
+
+		config.ContainerArgs = models.StringArray{}
+		for _, line := range strings.Split(c.FormValue("container_args"), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				config.ContainerArgs = append(config.ContainerArgs, line)
+			}
+		}
+
+		config.CPULimit, _ = strconv.ParseFloat(c.FormValue("cpu_limit"), 64)
+		config.MemoryLimitMB, _ = strconv.Atoi(c.FormValue("memory_limit_mb"))
+		config.PidsLimit, _ = strconv.ParseInt(c.FormValue("pids_limit"), 10, 64)
+		if config.CPULimit < 0 || config.MemoryLimitMB < 0 || config.PidsLimit < 0 {
+			return fmt.Errorf("resource limits must not be negative")
+		}
+		return nil
+	}
+
+	// Aturan freshness & umur backup (RPO) dari form
+	applyFreshness := func(c echo.Context, config *models.RestoreTestConfig) {
+		config.FreshnessTable = strings.TrimSpace(c.FormValue("freshness_table"))
+		config.FreshnessColumn = strings.TrimSpace(c.FormValue("freshness_column"))
+		config.FreshnessMaxAgeMinutes, _ = strconv.Atoi(c.FormValue("freshness_max_age_minutes"))
+		if config.FreshnessMaxAgeMinutes < 0 {
+			config.FreshnessMaxAgeMinutes = 0
+		}
+		config.MaxBackupAgeHours, _ = strconv.Atoi(c.FormValue("max_backup_age_hours"))
+		if config.MaxBackupAgeHours < 0 {
+			config.MaxBackupAgeHours = 0
+		}
+	}
+
+	// Koneksi DB sumber untuk perbandingan hasil restore (opsional)
+	// DSN berisi password production dan tidak dikirim balik ke form edit: field kosong = pakai DSN lama
+	applySourceCompare := func(c echo.Context, config *models.RestoreTestConfig) {
+		if dsn := strings.TrimSpace(c.FormValue("source_dsn")); dsn != "" {
+			config.SourceDSN = dsn
+		} else if c.FormValue("clear_source_dsn") == "true" {
+			config.SourceDSN = ""
+		}
+		config.CompareTolerancePercent, _ = strconv.ParseFloat(c.FormValue("compare_tolerance_percent"), 64)
+		if config.CompareTolerancePercent < 0 {
+			config.CompareTolerancePercent = 0
+		}
+	}
+
+	// Assertion checks dari form (input array check_name, check_query, check_type, check_expected)
+	parseChecks := func(c echo.Context) models.ValidationChecks {
+		form := c.Request().Form
+		names, queries := form["check_name"], form["check_query"]
+		types, expected := form["check_type"], form["check_expected"]
+
+		checks := models.ValidationChecks{}
+		for i := range queries {
+			if i >= len(names) || i >= len(types) || i >= len(expected) {
+				break
+			}
+			if strings.TrimSpace(queries[i]) == "" {
+				continue
+			}
+			name := strings.TrimSpace(names[i])
+			if name == "" {
+				name = fmt.Sprintf("Check #%d", i+1)
+			}
+			checks = append(checks, models.ValidationCheck{
+				Name:     name,
+				Query:    queries[i],
+				Type:     types[i],
+				Expected: strings.TrimSpace(expected[i]),
+			})
+		}
+		return checks
+	}
+
+	// Validasi cron dari form dan hitung jadwal pertama
+	applySchedule := func(c echo.Context, config *models.RestoreTestConfig) error {
+		config.CronExpression = strings.TrimSpace(c.FormValue("cron_expression"))
+		config.CronTimezone = c.FormValue("cron_timezone")
+		config.NextRunAt = nil
+
+		if config.CronExpression == "" {
+			return nil
+		}
+		next, err := scheduleService.NextRun(config.CronExpression, config.CronTimezone, time.Now())
+		if err != nil {
+			return err
+		}
+		config.NextRunAt = &next
+		return nil
+	}
+
 	e.POST("/api/tests", func(c echo.Context) error {
 		c.Request().ParseForm()
 		storageIDs := c.Request().Form["storage_ids"]
@@ -225,9 +393,21 @@ func main() {
 			DatabasusDatabaseName: c.FormValue("database_name"),
 			PreRestoreScript:      c.FormValue("pre_restore_script"),
 			PostRestoreScript:     c.FormValue("post_restore_script"),
+			Checks:                parseChecks(c),
 			StorageIDs:            storageIDs,
 			NotificationIDs:       notificationIDs,
+			NotifyOnSchemaChange:  c.FormValue("notify_on_schema_change") == "true",
+			DeepCheck:             c.FormValue("deep_check") == "true",
+		}
+		if err := applySchedule(c, &config); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
 		}
+		applyRunPolicy(c, &config)
+		applyFreshness(c, &config)
+		if err := applyContainer(c, &config); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		applySourceCompare(c, &config)
 
 		if err := database.DB.Create(&config).Error; err != nil {
 			return c.String(http.StatusBadRequest, "Failed to save: "+err.Error())
@@ -298,8 +478,20 @@ func main() {
 
 		test.PreRestoreScript = c.FormValue("pre_restore_script")
 		test.PostRestoreScript = c.FormValue("post_restore_script")
+		test.Checks = parseChecks(c)
 		test.StorageIDs = storageIDs
 		test.NotificationIDs = notificationIDs
+		test.NotifyOnSchemaChange = c.FormValue("notify_on_schema_change") == "true"
+		test.DeepCheck = c.FormValue("deep_check") == "true"
+		if err := applySchedule(c, &test); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		applyRunPolicy(c, &test)
+		applyFreshness(c, &test)
+		if err := applyContainer(c, &test); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		applySourceCompare(c, &test)
 
 		database.DB.Save(&test)
 		return c.Redirect(http.StatusFound, "/tests")
@@ -595,6 +787,107 @@ func main() {
 		return e.Renderer.(*TemplateRenderer).RenderDashboard(c.Response().Writer, "queue_list.html", echo.Map{"Jobs": jobs}, "queue")
 	})
 
+	// --- JOB DETAIL & LIVE LOG ---
+	e.GET("/jobs/:id", func(c echo.Context) error {
+		job, err := queueService.GetJobWithSteps(c.Param("id"))
+		if err != nil {
+			return c.Redirect(http.StatusFound, "/queue")
+		}
+		return e.Renderer.(*TemplateRenderer).RenderDashboard(c.Response().Writer, "job_detail.html", echo.Map{"Job": job}, "queue")
+	})
+
+	// Server-Sent Events: kirim baris log baru tiap detik sampai job selesai
+	e.GET("/api/jobs/:id/logs/stream", func(c echo.Context) error {
+		id := c.Param("id")
+		if _, err := queueService.GetJob(id); err != nil {
+			return c.String(http.StatusNotFound, err.Error())
+		}
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.Header().Set(echo.HeaderConnection, "keep-alive")
+		res.WriteHeader(http.StatusOK)
+
+		// offset dalam karakter (length / substring Postgres)
+		offset := 0
+		finalRead := false
+		for {
+			chunk, err := queueService.GetLogChunk(id, offset)
+			if err != nil {
+				fmt.Fprintf(res, "event: error\ndata: %s\n\n", err.Error())
+				res.Flush()
+				return nil
+			}
+
+			// Log lebih pendek dari yang sudah dikirim (ditulis ulang): client mengosongkan log lalu menerima dari awal
+			if chunk.LogLength < offset {
+				fmt.Fprint(res, "event: reset\ndata: \n\n")
+				offset = 0
+				if chunk, err = queueService.GetLogChunk(id, 0); err != nil {
+					return nil
+				}
+			}
+			if chunk.Chunk != "" {
+				for _, line := range strings.Split(strings.TrimRight(chunk.Chunk, "\n"), "\n") {
+					fmt.Fprintf(res, "data: %s\n\n", line)
+				}
+				offset = chunk.LogLength
+			}
+			res.Flush()
+
+			if chunk.Status != "PENDING" && chunk.Status != "RUNNING" {
+				// Satu kali baca lagi setelah status final: baris terakhir (notifikasi) bisa ditulis sesudahnya
+				if finalRead {
+					fmt.Fprintf(res, "event: done\ndata: %s\n\n", chunk.Status)
+					res.Flush()
+					return nil
+				}
+				finalRead = true
+			}
+
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case <-time.After(1 * time.Second):
+			}
+		}
+	})
+
+	// --- CANCEL JOB (Pending / Running) ---
+	e.POST("/api/jobs/:id/cancel", func(c echo.Context) error {
+		job, err := queueService.GetJob(c.Param("id"))
+		if err != nil {
+			return c.String(http.StatusNotFound, err.Error())
+		}
+
+		switch job.Status {
+		case "PENDING":
+			cancelled, err := queueService.CancelPendingJob(job.ID.String())
+			if err != nil {
+				return c.String(http.StatusInternalServerError, "Failed to cancel job: "+err.Error())
+			}
+			// Job baru saja diambil worker, batalkan lewat worker
+			if !cancelled && !bgWorker.CancelJob(job.ID) {
+				return c.String(http.StatusConflict, "Job has just started, please try again")
+			}
+		case "RUNNING":
+			// Job milik instance lain: tandai CANCELLED di DB, worker-nya berhenti saat heartbeat berikutnya
+			if !bgWorker.CancelJob(job.ID) {
+				cancelled, err := queueService.CancelRunningJob(job.ID.String())
+				if err != nil {
+					return c.String(http.StatusInternalServerError, "Failed to cancel job: "+err.Error())
+				}
+				if !cancelled {
+					return c.String(http.StatusBadRequest, "Job is already finished")
+				}
+			}
+		default:
+			return c.String(http.StatusBadRequest, "Job is already finished")
+		}
+		return c.Redirect(http.StatusFound, "/queue")
+	})
+
 	serverPort := os.Getenv("APP_PORT")
 	if serverPort == "" {
 		serverPort = "4006"
@@ -54,6 +54,7 @@ func migrate() {
 		&models.StorageConfig{},
 		&models.NotificationConfig{},
 		&models.Job{},
+		&models.JobStep{},
 		// Nanti kita tambah models lain disini (Queue, StorageConfig, dll)
 	)
 	if err != nil {
@@ -1,11 +1,122 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Sumber yang memicu job. Prioritas: manual > event (backup baru) > jadwal cron
+const (
+	TriggerManual    = "MANUAL"
+	TriggerNewBackup = "NEW_BACKUP"
+	TriggerSchedule  = "SCHEDULE"
+)
+
+// PriorityFor mengembalikan prioritas dequeue untuk sebuah trigger (semakin besar semakin didahulukan)
+func PriorityFor(trigger string) int {
+	switch trigger {
+	case TriggerManual:
+		return 30
+	case TriggerNewBackup:
+		return 20
+	case TriggerSchedule:
+		return 10
+	default:
+		return 0
+	}
+}
+
+// CheckResult hasil satu ValidationCheck pada sebuah job
+type CheckResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Actual  string `json:"actual"`
+	Message string `json:"message"`
+}
+
+type CheckResults []CheckResult
+
+func (a *CheckResults) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, a)
+}
+
+func (a CheckResults) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return "[]", nil
+	}
+	return json.Marshal(a)
+}
+
+// QueryResult result set dari query validasi (dibatasi jumlah barisnya) untuk ditampilkan di detail job
+type QueryResult struct {
+	Name      string     `json:"name"`
+	Columns   []string   `json:"columns"`
+	Rows      [][]string `json:"rows"`
+	RowCount  int        `json:"row_count"` // Jumlah baris yang terbaca, bisa lebih besar dari len(Rows)
+	Truncated bool       `json:"truncated"`
+}
+
+type QueryResults []QueryResult
+
+func (a *QueryResults) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, a)
+}
+
+func (a QueryResults) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return "[]", nil
+	}
+	return json.Marshal(a)
+}
+
+// SchemaDiff perubahan snapshot schema dibanding run sebelumnya dari test yang sama
+type SchemaDiff struct {
+	PreviousJobID       string   `json:"previous_job_id"`
+	PreviousFingerprint string   `json:"previous_fingerprint"`
+	Added               []string `json:"added"`
+	Removed             []string `json:"removed"`
+}
+
+func (d SchemaDiff) HasChanges() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0
+}
+
+func (d *SchemaDiff) Scan(value interface{}) error {
+	if value == nil {
+		*d = SchemaDiff{}
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, d)
+}
+
+func (d SchemaDiff) Value() (driver.Value, error) {
+	return json.Marshal(d)
+}
+
 type Job struct {
 	Base
 	// FIXED: Gunakan Pointer (*) agar bisa NULL di database
@@ -14,13 +125,39 @@ type Job struct {
 
 	// FIXED: Simpan nama test disini (Snapshot) agar kalau Config dihapus, nama tetap ada
 	TestSnapshotName string `gorm:"type:varchar(255)"`
+	WorkspaceID      string `gorm:"index"` // Snapshot workspace untuk fair queueing
+
+	Trigger  string // MANUAL, NEW_BACKUP, SCHEDULE
+	Priority int    `gorm:"default:0;index"`
+
+	// Retry: Attempt dimulai dari 1, OriginalJobID menunjuk ke job percobaan pertama
+	Attempt       int        `gorm:"default:1"`
+	OriginalJobID *uuid.UUID `gorm:"type:uuid;index"`
+	RunAfter      *time.Time `gorm:"index"` // Job PENDING baru boleh diambil setelah waktu ini (backoff)
 
-	Status                string `gorm:"default:'PENDING';index"`
+	Status                string `gorm:"default:'PENDING';index"` // PENDING, RUNNING, SUCCESS, WARNING, FAILED, CANCELLED
 	StartedAt             *time.Time
+	HeartbeatAt           *time.Time `gorm:"index"` // Diupdate worker berkala selama RUNNING
 	FinishedAt            *time.Time
 	DurationSeconds       int
 	LogOutput             string `gorm:"type:text"`
 	LastProcessedBackupID string
+
+	BackupSHA256           string // Checksum file backup lokal yang diupload ke storage
+	RestoreDurationSeconds int    // Lama fase restore (trigger sampai selesai), dibandingkan dengan RTOTargetMinutes
+
+	// Hasil validasi
+	CheckResults CheckResults `gorm:"type:jsonb"`
+	QueryResults QueryResults `gorm:"type:jsonb"` // Result set post-restore script & checks
+
+	// Schema fingerprint (sha256 dari snapshot schema yang sudah diurutkan)
+	SchemaFingerprint string
+	SchemaSnapshot    StringArray `gorm:"type:jsonb"`
+	SchemaDiff        SchemaDiff  `gorm:"type:jsonb"`
+
+	IntegrityFindings StringArray `gorm:"type:jsonb"` // Temuan korupsi dari deep check
+
+	Steps []JobStep `gorm:"foreignKey:JobID"` // Timeline fase (di-preload di halaman detail)
 }
 
 func (j *Job) MarkFinished(status string, logs string) {
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Fase-fase yang dilalui setiap job (urutan sesuai processJob)
+const (
+	StepFetchBackup    = "FETCH_BACKUP"
+	StepResolveVersion = "RESOLVE_VERSION"
+	StepSpawnContainer = "SPAWN_CONTAINER"
+	StepWaitReady      = "WAIT_READY"
+	StepPreRestore     = "PRE_RESTORE_SCRIPT"
+	StepRestore        = "RESTORE"
+	StepSchema         = "SCHEMA_FINGERPRINT"
+	StepValidate       = "VALIDATE"
+	StepFreshness      = "FRESHNESS"
+	StepCompareSource  = "COMPARE_SOURCE"
+	StepDeepCheck      = "DEEP_CHECK"
+	StepUpload         = "UPLOAD"
+	StepNotify         = "NOTIFY"
+)
+
+// JobStep mencatat satu fase eksekusi job untuk timeline & statistik
+type JobStep struct {
+	Base
+	JobID        uuid.UUID `gorm:"type:uuid;index;not null"`
+	Name         string    `gorm:"index;not null"`
+	Position     int
+	Status       string `gorm:"index"` // RUNNING, SUCCESS, FAILED, CANCELLED, SKIPPED
+	StartedAt    time.Time
+	FinishedAt   *time.Time
+	DurationMs   int64
+	ErrorMessage string `gorm:"type:text"`
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"time"
 )
 
 // Helper untuk menyimpan Array string sebagai JSON di Postgres
@@ -24,6 +25,43 @@ func (a StringArray) Value() (driver.Value, error) {
 	return json.Marshal(a)
 }
 
+// Tipe ekspektasi untuk ValidationCheck
+const (
+	CheckRowsGTE  = "ROWS_GTE"  // Jumlah baris >= Expected
+	CheckScalarEq = "SCALAR_EQ" // Kolom pertama baris pertama == Expected
+	CheckNoRows   = "NO_ROWS"   // Query tidak mengembalikan baris
+	CheckRegex    = "REGEX"     // Kolom pertama baris pertama match regex Expected
+)
+
+// ValidationCheck adalah satu assertion bernama yang dijalankan ke DB hasil restore
+type ValidationCheck struct {
+	Name     string `json:"name"`
+	Query    string `json:"query"`
+	Type     string `json:"type"`
+	Expected string `json:"expected"`
+}
+
+type ValidationChecks []ValidationCheck
+
+func (a *ValidationChecks) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, a)
+}
+
+func (a ValidationChecks) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return "[]", nil
+	}
+	return json.Marshal(a)
+}
+
 type RestoreTestConfig struct {
 	Base
 	Name                  string `gorm:"not null"`
@@ -35,10 +73,59 @@ type RestoreTestConfig struct {
 	PreRestoreScript  string `gorm:"type:text"`
 	PostRestoreScript string `gorm:"type:text"`
 
+	// Assertion per test, hasilnya disimpan di Job.CheckResults
+	Checks ValidationChecks `gorm:"type:jsonb"`
+
 	// Relations (Changed to Array for Multiple Selection)
 	StorageIDs      StringArray `gorm:"type:jsonb"` // Stores ["uuid-1", "uuid-2"]
 	NotificationIDs StringArray `gorm:"type:jsonb"` // Stores ["uuid-1", "uuid-2"]
 
+	// Kirim notifikasi terpisah jika schema berubah dibanding run sebelumnya
+	NotifyOnSchemaChange bool `gorm:"default:false"`
+
+	// Schedule (Cron). Kosong = hanya jalan manual
+	CronExpression string
+	CronTimezone   string // Kosong = pakai AppSettings.AppTimezone
+	NextRunAt      *time.Time
+
+	// Container ephemeral custom (PostGIS, TimescaleDB, pgvector, dll). Image boleh memakai {{version}}
+	ContainerImage string
+	ContainerEnv   StringArray `gorm:"type:jsonb"` // ["KEY=VALUE", ...]
+	ContainerArgs  StringArray `gorm:"type:jsonb"` // Argumen command container, mis. ["-c", "shared_preload_libraries=timescaledb"]
+
+	// Batas resource container ephemeral, 0 = tanpa batas
+	CPULimit      float64
+	MemoryLimitMB int
+	PidsLimit     int64
+
+	// Batas waktu menunggu restore Databasus selesai
+	RestoreTimeoutMinutes int `gorm:"default:60"`
+
+	// Target RTO untuk fase restore. Restore sukses yang melewati target dicatat WARNING. 0 = tidak dicek
+	RTOTargetMinutes int
+
+	// Retry Policy. MaxAttempts 1 = tanpa retry. Delay = RetryBackoffSeconds * 2^(attempt-1)
+	MaxAttempts         int `gorm:"default:1"`
+	RetryBackoffSeconds int `gorm:"default:60"`
+
+	// Umur backup maksimal (jam) saat job dimulai. Backup lebih tua langsung FAILED. 0 = tidak dicek
+	MaxBackupAgeHours int
+
+	// Freshness (RPO): baris terbaru di FreshnessTable.FreshnessColumn tidak boleh lebih tua
+	// dari FreshnessMaxAgeMinutes dihitung dari waktu backup dibuat. Kosong = tidak dicek
+	FreshnessTable         string
+	FreshnessColumn        string
+	FreshnessMaxAgeMinutes int
+
+	// Deep check: pg_amcheck / amcheck untuk cek korupsi heap & index B-tree
+	DeepCheck bool `gorm:"default:false"`
+
+	// Perbandingan dengan DB sumber (opsional). Koneksi dipakai read-only.
+	// DSN berisi password production: tidak pernah dirender ulang ke form maupun JSON
+	SourceDSN               string  `json:"-"`
+	CompareTolerancePercent float64 `gorm:"default:0"` // Selisih row count maksimal per tabel
+
 	// State Polling
 	LastProcessedBackupID string
+	LastTriggeredBackupID string // Backup terakhir yang sudah di-enqueue oleh BackupWatcher
 }
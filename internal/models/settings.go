@@ -10,6 +10,10 @@ type AppSettings struct {
 	AppTimezone       string
 	DatabasusTimezone string
 	LogRetentionDays  int
+
+	// Worker Pool (berlaku setelah restart)
+	WorkerConcurrency int `gorm:"default:1"`
+	MaxContainers     int `gorm:"default:2"`
 }
 
 // Helper (Tetap sama)
@@ -21,6 +25,8 @@ func GetSettings(db *gorm.DB) AppSettings {
 			AppTimezone:       "Asia/Jakarta",
 			DatabasusTimezone: "UTC",
 			LogRetentionDays:  30,
+			WorkerConcurrency: 1,
+			MaxContainers:     2,
 		}
 		db.Create(&settings)
 	}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type CompareService struct{}
+
+type TableRowDiff struct {
+	Table        string
+	SourceRows   int64
+	RestoredRows int64
+	DiffPercent  float64
+}
+
+// ComparisonReport hasil perbandingan DB sumber (live) dengan DB hasil restore
+type ComparisonReport struct {
+	Tables         []TableRowDiff
+	MissingObjects []string // Ada di sumber, tidak ada di hasil restore
+	ExtraObjects   []string // Ada di hasil restore, tidak ada di sumber (mis. dari pre-restore script), hanya informasi
+	Violations     []string // Perbedaan yang melewati toleransi
+}
+
+// Query daftar objek schema (tabel, view, sequence, index, function) dalam format "kind:schema.name"
+const schemaObjectsQuery = `
+SELECT CASE c.relkind
+         WHEN 'r' THEN 'table' WHEN 'p' THEN 'table' WHEN 'v' THEN 'view'
+         WHEN 'm' THEN 'materialized view' WHEN 'S' THEN 'sequence'
+         WHEN 'i' THEN 'index' WHEN 'f' THEN 'foreign table'
+       END || ':' || n.nspname || '.' || c.relname AS object
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname NOT IN ('pg_catalog', 'information_schema', 'pg_toast')
+  AND n.nspname NOT LIKE 'pg_temp%'
+  AND c.relkind IN ('r', 'p', 'v', 'm', 'S', 'i', 'f')
+UNION ALL
+SELECT 'function:' || n.nspname || '.' || p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')'
+FROM pg_proc p
+JOIN pg_namespace n ON n.oid = p.pronamespace
+WHERE n.nspname NOT IN ('pg_catalog', 'information_schema')`
+
+const userTablesQuery = `
+SELECT table_schema, table_name
+FROM information_schema.tables
+WHERE table_type = 'BASE TABLE'
+  AND table_schema NOT IN ('pg_catalog', 'information_schema')
+ORDER BY table_schema, table_name`
+
+// Batas waktu koneksi awal ke database sumber
+const sourceConnectTimeout = 10 * time.Second
+
+// OpenSource membuka koneksi ke database sumber dan memastikan host bisa dijangkau (ping).
+// Semua query dijalankan di transaksi READ ONLY.
+func (s *CompareService) OpenSource(ctx context.Context, dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to source database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to source database: %v", err)
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, sourceConnectTimeout)
+	defer cancel()
+	if err := sqlDB.PingContext(pingCtx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to connect to source database: %v", err)
+	}
+	return db, nil
+}
+
+// Batas waktu per statement & tunggu lock saat membaca DB sumber (production),
+// agar count(*) tabel besar atau tabel yang sedang di-lock tidak menggantung / membebani sumber.
+const (
+	sourceStatementTimeout = "60s"
+	sourceLockTimeout      = "5s"
+)
+
+// Compare membandingkan row count per tabel dan daftar objek schema.
+// Row count boleh berbeda sampai tolerancePercent (data sumber terus berubah setelah backup),
+// objek schema yang hilang di hasil restore selalu dianggap pelanggaran. Objek yang hanya ada
+// di hasil restore (extension / role dari pre-restore script) dicatat di ExtraObjects saja.
+func (s *CompareService) Compare(ctx context.Context, source, restored *gorm.DB, tolerancePercent float64) (*ComparisonReport, error) {
+	report := &ComparisonReport{}
+
+	var sourceObjects, restoredObjects []string
+	var sourceCounts, restoredCounts map[string]int64
+
+	err := source.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if err = tx.Exec("SET LOCAL statement_timeout = '" + sourceStatementTimeout + "'").Error; err != nil {
+			return err
+		}
+		if err = tx.Exec("SET LOCAL lock_timeout = '" + sourceLockTimeout + "'").Error; err != nil {
+			return err
+		}
+		if err = tx.Raw(schemaObjectsQuery).Scan(&sourceObjects).Error; err != nil {
+			return err
+		}
+		sourceCounts, err = s.countRows(tx)
+		return err
+	}, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect source database: %v", err)
+	}
+
+	restoredDB := restored.WithContext(ctx)
+	if err := restoredDB.Raw(schemaObjectsQuery).Scan(&restoredObjects).Error; err != nil {
+		return nil, fmt.Errorf("failed to inspect restored database: %v", err)
+	}
+	restoredCounts, err = s.countRows(restoredDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count restored rows: %v", err)
+	}
+
+	report.MissingObjects, report.ExtraObjects = diffStrings(sourceObjects, restoredObjects)
+	for _, obj := range report.MissingObjects {
+		report.Violations = append(report.Violations, fmt.Sprintf("missing in restore: %s", obj))
+	}
+
+	tables := make([]string, 0, len(sourceCounts))
+	for table := range sourceCounts {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		restoredRows, ok := restoredCounts[table]
+		if !ok {
+			continue // Sudah tercatat sebagai missing object
+		}
+		sourceRows := sourceCounts[table]
+		diff := TableRowDiff{
+			Table:        table,
+			SourceRows:   sourceRows,
+			RestoredRows: restoredRows,
+			DiffPercent:  math.Abs(float64(sourceRows-restoredRows)) / math.Max(float64(sourceRows), 1) * 100,
+		}
+		report.Tables = append(report.Tables, diff)
+
+		if diff.DiffPercent > tolerancePercent {
+			report.Violations = append(report.Violations, fmt.Sprintf("row count %s: source %d, restored %d (%.2f%% > %.2f%%)",
+				table, sourceRows, restoredRows, diff.DiffPercent, tolerancePercent))
+		}
+	}
+
+	return report, nil
+}
+
+func (s *CompareService) countRows(db *gorm.DB) (map[string]int64, error) {
+	rows, err := db.Raw(userTablesQuery).Rows()
+	if err != nil {
+		return nil, err
+	}
+	var tables [][2]string
+	for rows.Next() {
+		var schema, name string
+		if err := rows.Scan(&schema, &name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, [2]string{schema, name})
+	}
+	rows.Close()
+
+	counts := make(map[string]int64, len(tables))
+	for _, t := range tables {
+		var count int64
+		query := fmt.Sprintf("SELECT count(*) FROM %s.%s", quoteIdent(t[0]), quoteIdent(t[1]))
+		if err := db.Raw(query).Scan(&count).Error; err != nil {
+			return nil, fmt.Errorf("count %s.%s: %v", t[0], t[1], err)
+		}
+		counts[t[0]+"."+t[1]] = count
+	}
+	return counts, nil
+}
+
+// diffStrings mengembalikan elemen yang hanya ada di a (missing) dan hanya ada di b (extra)
+func diffStrings(a, b []string) ([]string, []string) {
+	inA := make(map[string]bool, len(a))
+	for _, v := range a {
+		inA[v] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, v := range b {
+		inB[v] = true
+	}
+
+	var missing, extra []string
+	for v := range inA {
+		if !inB[v] {
+			missing = append(missing, v)
+		}
+	}
+	for v := range inB {
+		if !inA[v] {
+			extra = append(extra, v)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
+
+// quoteIdent meng-quote identifier Postgres (schema, tabel, kolom)
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
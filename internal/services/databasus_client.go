@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"databasus-checker/internal/database"
 	"databasus-checker/internal/models"
 	"encoding/json"
@@ -9,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -39,27 +41,101 @@ type PostgresMeta struct {
 	Version string `json:"version"`
 }
 
+// Metadata MySQL / MariaDB / MongoDB, struktur sama dengan PostgresMeta
+type VersionMeta struct {
+	Version string `json:"version"`
+}
+
 type DatabaseDTO struct {
 	ID         string       `json:"id"`
 	Name       string       `json:"name"`
 	Type       string       `json:"type"`
 	Postgresql PostgresMeta `json:"postgresql"` // Nested JSON
+	Mysql      VersionMeta  `json:"mysql"`
+	Mariadb    VersionMeta  `json:"mariadb"`
+	Mongodb    VersionMeta  `json:"mongodb"`
+}
+
+// EngineVersion versi database sesuai Type (kosong jika Databasus tidak mengirim versi)
+func (d DatabaseDTO) EngineVersion() string {
+	switch strings.ToLower(d.Type) {
+	case EngineMySQL:
+		return d.Mysql.Version
+	case EngineMariaDB:
+		return d.Mariadb.Version
+	case EngineMongoDB:
+		// Image mongo cukup pakai major version ("7.0.14" -> "7")
+		return strings.SplitN(d.Mongodb.Version, ".", 2)[0]
+	default:
+		return d.Postgresql.Version
+	}
+}
+
+// DatabasusTime timestamp dari Databasus. Databasus bisa mengirim jam lokal server tanpa zona;
+// HasZone membedakannya dari waktu yang memang UTC ("Z" / "+00:00").
+type DatabasusTime struct {
+	time.Time
+	HasZone bool
+}
+
+func (t *DatabasusTime) UnmarshalJSON(data []byte) error {
+	var raw *string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil || *raw == "" {
+		*t = DatabasusTime{}
+		return nil
+	}
+	if parsed, err := time.Parse(time.RFC3339Nano, *raw); err == nil {
+		*t = DatabasusTime{Time: parsed, HasZone: true}
+		return nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"} {
+		if parsed, err := time.Parse(layout, *raw); err == nil {
+			*t = DatabasusTime{Time: parsed}
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid timestamp %q", *raw)
+}
+
+// InZone menerapkan zona waktu Databasus (AppSettings.DatabasusTimezone) hanya pada timestamp tanpa zona.
+// Timestamp dengan zona eksplisit, termasuk UTC, tidak diubah.
+func (t DatabasusTime) InZone(timezone string) time.Time {
+	if t.HasZone || t.IsZero() || timezone == "" || timezone == "UTC" {
+		return t.Time
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return t.Time
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
 }
 
 // Structs untuk Backup & Restore
 type BackupDTO struct {
-	ID        string    `json:"id"`
-	CreatedAt time.Time `json:"createdAt"`
-	Status    string    `json:"status"`
-	FilePath  string    `json:"filePath"`
+	ID        string        `json:"id"`
+	CreatedAt DatabasusTime `json:"createdAt"`
+	Status    string        `json:"status"`
+	FilePath  string        `json:"filePath"`
+}
+
+// CreatedAtIn waktu pembuatan backup di zona waktu Databasus (lihat DatabasusTime.InZone)
+func (b BackupDTO) CreatedAtIn(timezone string) time.Time {
+	return b.CreatedAt.InZone(timezone)
 }
 
 type BackupsResponse struct {
 	Backups []BackupDTO `json:"backups"`
 }
 
-type RestorePayload struct {
-	PostgresConfig map[string]interface{} `json:"postgresqlDatabase"`
+type RestoreDTO struct {
+	ID          string        `json:"id"`
+	BackupID    string        `json:"backupId"`
+	Status      string        `json:"status"` // IN_PROGRESS, COMPLETED, FAILED
+	FailMessage *string       `json:"failMessage"`
+	CreatedAt   DatabasusTime `json:"createdAt"`
 }
 
 // --- Logic ---
@@ -82,13 +158,16 @@ func (c *DatabasusClient) CheckHealth() bool {
 	return resp.StatusCode == http.StatusOK
 }
 
-func (c *DatabasusClient) getToken(settings models.AppSettings) (string, error) {
+func (c *DatabasusClient) getToken(ctx context.Context, settings models.AppSettings) (string, error) {
 	reqBody, _ := json.Marshal(LoginRequest{
 		Email:    settings.DatabasusUser,
 		Password: settings.DatabasusPassword,
 	})
 
-	resp, err := http.Post(settings.DatabasusURL+"/api/v1/users/signin", "application/json", bytes.NewBuffer(reqBody))
+	req, _ := http.NewRequestWithContext(ctx, "POST", settings.DatabasusURL+"/api/v1/users/signin", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -108,7 +187,7 @@ func (c *DatabasusClient) getToken(settings models.AppSettings) (string, error)
 
 func (c *DatabasusClient) GetWorkspaces() ([]WorkspaceDTO, error) {
 	settings := models.GetSettings(database.DB)
-	token, err := c.getToken(settings)
+	token, err := c.getToken(context.Background(), settings)
 	if err != nil {
 		return nil, err
 	}
@@ -135,15 +214,15 @@ func (c *DatabasusClient) GetWorkspaces() ([]WorkspaceDTO, error) {
 	return result.Workspaces, nil
 }
 
-func (c *DatabasusClient) GetDatabases(workspaceID string) ([]DatabaseDTO, error) {
+func (c *DatabasusClient) GetDatabases(ctx context.Context, workspaceID string) ([]DatabaseDTO, error) {
 	settings := models.GetSettings(database.DB)
-	token, err := c.getToken(settings)
+	token, err := c.getToken(ctx, settings)
 	if err != nil {
 		return nil, err
 	}
 
 	url := fmt.Sprintf("%s/api/v1/databases?workspace_id=%s", settings.DatabasusURL, workspaceID)
-	req, _ := http.NewRequest("GET", url, nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
 	req.Header.Set("Authorization", "Bearer "+token)
 
 	client := &http.Client{Timeout: 10 * time.Second}
@@ -165,30 +244,36 @@ func (c *DatabasusClient) GetDatabases(workspaceID string) ([]DatabaseDTO, error
 	return result, nil
 }
 
-// NEW HELPER: Ambil detail database spesifik (termasuk version)
-func (c *DatabasusClient) GetDatabaseVersion(workspaceID, databaseID string) (string, error) {
+// NEW HELPER: Ambil engine & version database spesifik
+func (c *DatabasusClient) GetDatabaseEngine(ctx context.Context, workspaceID, databaseID string) (DatabaseEngine, string, error) {
 	// Karena API Databasus tidak punya endpoint GetDatabaseByID, kita pakai GetDatabases filter by workspace
 	// lalu cari manual di array
-	dbs, err := c.GetDatabases(workspaceID)
+	postgresEngine, _ := EngineFor(EnginePostgres)
+	dbs, err := c.GetDatabases(ctx, workspaceID)
 	if err != nil {
-		return "", err
+		return postgresEngine, postgresEngine.DefaultVersion, err
 	}
 
 	for _, db := range dbs {
 		if db.ID == databaseID {
-			if db.Postgresql.Version == "" {
-				return "15", nil // Default fallback
+			engine, err := EngineFor(db.Type)
+			if err != nil {
+				return engine, "", err
+			}
+			version := db.EngineVersion()
+			if version == "" {
+				version = engine.DefaultVersion // Default fallback
 			}
-			return db.Postgresql.Version, nil
+			return engine, version, nil
 		}
 	}
-	return "15", nil // Default jika tidak ketemu (aman)
+	return postgresEngine, postgresEngine.DefaultVersion, nil // Default jika tidak ketemu (aman)
 }
 
 // Test Storage Connection (Proxy)
 func (c *DatabasusClient) TestStorageConnection(payload map[string]interface{}) error {
 	settings := models.GetSettings(database.DB)
-	token, err := c.getToken(settings)
+	token, err := c.getToken(context.Background(), settings)
 	if err != nil {
 		return err
 	}
@@ -221,16 +306,16 @@ func (c *DatabasusClient) TestStorageConnection(payload map[string]interface{})
 	return nil
 }
 
-func (c *DatabasusClient) GetLatestBackup(databaseID string) (*BackupDTO, error) {
+func (c *DatabasusClient) GetLatestBackup(ctx context.Context, databaseID string) (*BackupDTO, error) {
 	settings := models.GetSettings(database.DB)
-	token, err := c.getToken(settings)
+	token, err := c.getToken(ctx, settings)
 	if err != nil {
 		return nil, err
 	}
 
 	// Filter by database_id, sort desc, limit 1
 	url := fmt.Sprintf("%s/api/v1/backups?database_id=%s&limit=1&sort=created_at:desc", settings.DatabasusURL, databaseID)
-	req, _ := http.NewRequest("GET", url, nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
 	req.Header.Set("Authorization", "Bearer "+token)
 
 	client := &http.Client{Timeout: 10 * time.Second}
@@ -261,28 +346,23 @@ func (c *DatabasusClient) GetLatestBackup(databaseID string) (*BackupDTO, error)
 	return &result.Backups[0], nil
 }
 
-func (c *DatabasusClient) TriggerRestore(backupID string, targetHost string, targetPort int, targetUser, targetPass, targetDB string) error {
+// TriggerRestore memulai restore dan mengembalikan ID restore dari response (kosong jika Databasus tidak mengirimnya)
+func (c *DatabasusClient) TriggerRestore(ctx context.Context, backupID string, engine DatabaseEngine, targetHost string, targetPort int, targetUser, targetPass, targetDB string) (string, error) {
 	settings := models.GetSettings(database.DB)
-	token, err := c.getToken(settings)
+	token, err := c.getToken(ctx, settings)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	payload := RestorePayload{
-		PostgresConfig: map[string]interface{}{
-			"host":     targetHost,
-			"port":     targetPort,
-			"username": targetUser,
-			"password": targetPass,
-			"database": targetDB,
-			"sslmode":  "disable",
-		},
+	// Key target tergantung engine: postgresqlDatabase, mysqlDatabase, mariadbDatabase
+	payload := map[string]interface{}{
+		engine.RestoreKey: engine.RestoreTarget(targetHost, targetPort, targetUser, targetPass, targetDB),
 	}
 
 	reqBody, _ := json.Marshal(payload)
 	url := fmt.Sprintf("%s/api/v1/restores/%s/restore", settings.DatabasusURL, backupID)
 
-	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
+	req, _ := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/json")
 
@@ -291,14 +371,124 @@ func (c *DatabasusClient) TriggerRestore(backupID string, targetHost string, tar
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
+	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != 200 && resp.StatusCode != 201 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("restore api failed (%d): %s", resp.StatusCode, string(body))
+		return "", fmt.Errorf("restore api failed (%d): %s", resp.StatusCode, string(body))
 	}
 
-	return nil
+	var created struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(body, &created) // Body opsional, tanpa ID worker mencocokkan restore lewat waktu mulai
+	return created.ID, nil
+}
+
+// Toleransi selisih jam checker & Databasus saat mencocokkan restore lewat waktu mulai
+const restoreClockSkew = 5 * time.Second
+
+// GetRestore mengambil restore milik job ini. Jika restoreID diketahui, restore dicari berdasarkan ID;
+// jika tidak, diambil restore terbaru yang dibuat setelah notBefore, agar restore lama dari backup yang sama
+// (retry, re-run cron / watcher) tidak ikut terbaca.
+func (c *DatabasusClient) GetRestore(ctx context.Context, backupID, restoreID string, notBefore time.Time) (*RestoreDTO, error) {
+	settings := models.GetSettings(database.DB)
+	token, err := c.getToken(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/api/v1/restores/%s", settings.DatabasusURL, backupID)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to fetch restores (status: %d)", resp.StatusCode)
+	}
+
+	var restores []RestoreDTO
+	if err := json.NewDecoder(resp.Body).Decode(&restores); err != nil {
+		return nil, err
+	}
+
+	if restoreID != "" {
+		for i := range restores {
+			if restores[i].ID == restoreID {
+				return &restores[i], nil
+			}
+		}
+		return nil, fmt.Errorf("restore %s not found for this backup", restoreID)
+	}
+
+	var latest *RestoreDTO
+	for i := range restores {
+		createdAt := restores[i].CreatedAt.InZone(settings.DatabasusTimezone)
+		if createdAt.Before(notBefore.Add(-restoreClockSkew)) {
+			continue
+		}
+		if latest == nil || restores[i].CreatedAt.After(latest.CreatedAt.Time) {
+			latest = &restores[i]
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no restore started after %s found for this backup", notBefore.Format(time.RFC3339))
+	}
+	return latest, nil
+}
+
+// WaitForRestore polling status restore (lihat GetRestore) sampai COMPLETED / FAILED atau timeout.
+// onStatusChange dipanggil setiap status restore berubah (untuk logging).
+func (c *DatabasusClient) WaitForRestore(ctx context.Context, backupID, restoreID string, notBefore time.Time, timeout time.Duration, onStatusChange func(status string)) (*RestoreDTO, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	lastStatus := ""
+	var lastErr error
+	for {
+		restore, err := c.GetRestore(ctx, backupID, restoreID, notBefore)
+		lastErr = err
+		if err == nil && restore.Status != lastStatus {
+			lastStatus = restore.Status
+			if onStatusChange != nil {
+				onStatusChange(restore.Status)
+			}
+		}
+
+		if err == nil {
+			switch restore.Status {
+			case "COMPLETED", "SUCCESS":
+				return restore, nil
+			case "FAILED":
+				msg := "unknown error"
+				if restore.FailMessage != nil && *restore.FailMessage != "" {
+					msg = *restore.FailMessage
+				}
+				return restore, fmt.Errorf("databasus restore failed: %s", msg)
+			}
+		}
+
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				if lastStatus == "" {
+					lastStatus = "unknown"
+				}
+				if lastErr != nil {
+					return nil, fmt.Errorf("restore did not finish within %s (last status: %s, last error: %v)", timeout, lastStatus, lastErr)
+				}
+				return nil, fmt.Errorf("restore did not finish within %s (last status: %s)", timeout, lastStatus)
+			}
+			return nil, ctx.Err()
+		}
+	}
 }
@@ -1,44 +1,50 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"math/rand"
-	"net"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 )
 
+// Nama network default untuk container restore, bisa diganti lewat env RESTORE_NETWORK
+const defaultRestoreNetwork = "databasus-checker-restore"
+
+// Label container restore, dipakai sweeper untuk mencari container milik job
+const (
+	containerNamePrefix = "restore_job_"
+	labelManaged        = "databasus-checker.managed"
+	labelJobID          = "databasus-checker.job-id"
+	labelExpiresAt      = "databasus-checker.expires-at" // RFC3339, setelah ini container dianggap tertinggal
+)
+
 type DockerService struct{}
 
 type EphemeralDB struct {
+	Engine      DatabaseEngine
 	ContainerID string
-	Port        int
+	Host        string // Nama container, di-resolve oleh DNS Docker di dalam restore network
+	Port        int    // Port di dalam container (tidak dipublish ke host)
 	User        string
 	Password    string
 	DBName      string
 	Version     string
 }
 
-// Helper: Cari port host yang kosong
-func getFreePort() (int, error) {
-	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
-	if err != nil {
-		return 0, err
-	}
-	l, err := net.ListenTCP("tcp", addr)
-	if err != nil {
-		return 0, err
-	}
-	defer l.Close()
-	return l.Addr().(*net.TCPAddr).Port, nil
-}
-
 // Helper: Random String
 func randomString(n int) string {
 	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
@@ -49,21 +55,46 @@ func randomString(n int) string {
 	return string(b)
 }
 
-// FIXED: Tambahkan parameter pgVersion
-func (s *DockerService) SpawnPostgres(jobID string, pgVersion string) (*EphemeralDB, error) {
-	ctx := context.Background()
+// ContainerOptions pengaturan container per test
+type ContainerOptions struct {
+	Image string   // Override image engine, "{{version}}" diganti versi database
+	Env   []string // Env tambahan format KEY=VALUE
+	Args  []string // Argumen command (Cmd) container
+
+	// Batas resource, 0 = tanpa batas
+	CPULimit      float64 // Jumlah core, mis. 1.5
+	MemoryLimitMB int
+	PidsLimit     int64
+
+	// Umur maksimal container sebelum dihapus sweeper walaupun job masih RUNNING, 0 = pakai default sweeper
+	MaxLifetime time.Duration
+}
+
+// ImageFor menentukan image yang dipakai: override per test atau image default engine
+func (o ContainerOptions) ImageFor(engine DatabaseEngine, version string) string {
+	if o.Image == "" {
+		return engine.Image(version)
+	}
+	if version == "" {
+		version = engine.DefaultVersion
+	}
+	return strings.ReplaceAll(o.Image, "{{version}}", version)
+}
+
+// SpawnDatabase membuat container ephemeral sesuai engine & versi database sumber
+func (s *DockerService) SpawnDatabase(ctx context.Context, jobID string, engine DatabaseEngine, version string, opts ContainerOptions) (*EphemeralDB, error) {
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create docker client: %v", err)
 	}
 
 	// Fallback version
-	if pgVersion == "" {
-		pgVersion = "15"
+	if version == "" {
+		version = engine.DefaultVersion
 	}
 
 	// 1. Generate Credentials
-	dbUser := "user_" + randomString(5)
+	dbUser := engine.AdminUser("user_" + randomString(5))
 	dbPass := "pass_" + randomString(8)
 	cleanJobID := strings.ReplaceAll(jobID, "-", "")
 	if len(cleanJobID) > 8 {
@@ -71,14 +102,13 @@ func (s *DockerService) SpawnPostgres(jobID string, pgVersion string) (*Ephemera
 	}
 	dbName := "db_" + cleanJobID
 
-	hostPort, err := getFreePort()
+	networkName, err := s.EnsureRestoreNetwork(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find free port: %v", err)
+		return nil, err
 	}
 
-	// 2. Pull Image (Dynamic Version)
-	// Gunakan alpine agar ringan
-	imageName := fmt.Sprintf("postgres:%s-alpine", pgVersion)
+	// 2. Pull Image (Dynamic Version / override per test)
+	imageName := opts.ImageFor(engine, version)
 
 	// Cek apakah image ada, kalau tidak ada PULL dulu
 	_, _, err = cli.ImageInspectWithRaw(ctx, imageName)
@@ -94,29 +124,49 @@ func (s *DockerService) SpawnPostgres(jobID string, pgVersion string) (*Ephemera
 		return nil, fmt.Errorf("failed to inspect image: %v", err)
 	}
 
-	// 3. Create Container
+	// 3. Create Container. Env custom tidak boleh menimpa kredensial yang dipakai checker & Databasus
+	for _, env := range opts.Env {
+		if key, _, _ := strings.Cut(env, "="); IsCredentialEnv(key) {
+			return nil, fmt.Errorf("container env %s would override the database credentials", key)
+		}
+	}
 	containerConfig := &container.Config{
 		Image: imageName,
-		Env: []string{
-			"POSTGRES_USER=" + dbUser,
-			"POSTGRES_PASSWORD=" + dbPass,
-			"POSTGRES_DB=" + dbName,
+		Env:   append(engine.ContainerEnv(dbUser, dbPass, dbName), opts.Env...),
+		Labels: map[string]string{
+			labelManaged: "true",
+			labelJobID:   jobID,
 		},
 	}
+	if opts.MaxLifetime > 0 {
+		containerConfig.Labels[labelExpiresAt] = time.Now().Add(opts.MaxLifetime).UTC().Format(time.RFC3339)
+	}
+	if len(opts.Args) > 0 {
+		containerConfig.Cmd = opts.Args
+	}
 
+	// Port tidak dipublish: container hanya bisa dijangkau dari dalam restore network
 	hostConfig := &container.HostConfig{
-		PortBindings: nat.PortMap{
-			"5432/tcp": []nat.PortBinding{
-				{
-					HostIP:   "0.0.0.0",
-					HostPort: fmt.Sprintf("%d", hostPort),
-				},
-			},
-		},
-		AutoRemove: false,
+		NetworkMode: container.NetworkMode(networkName),
+		AutoRemove:  false,
+	}
+	if opts.CPULimit > 0 {
+		hostConfig.NanoCPUs = int64(opts.CPULimit * 1e9)
+	}
+	if opts.MemoryLimitMB > 0 {
+		hostConfig.Memory = int64(opts.MemoryLimitMB) * 1024 * 1024
+	}
+	if opts.PidsLimit > 0 {
+		pids := opts.PidsLimit
+		hostConfig.PidsLimit = &pids
+	}
+
+	networkingConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{networkName: {}},
 	}
 
-	resp, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "restore_job_"+jobID)
+	containerName := containerNamePrefix + jobID
+	resp, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, containerName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create container: %v", err)
 	}
@@ -127,15 +177,98 @@ func (s *DockerService) SpawnPostgres(jobID string, pgVersion string) (*Ephemera
 	}
 
 	return &EphemeralDB{
+		Engine:      engine,
 		ContainerID: resp.ID,
-		Port:        hostPort,
+		Host:        containerName,
+		Port:        nat.Port(engine.ContainerPort).Int(),
 		User:        dbUser,
 		Password:    dbPass,
 		DBName:      dbName,
-		Version:     pgVersion,
+		Version:     version,
 	}, nil
 }
 
+// Setup network dijalankan satu per satu: worker pool bisa spawn container bersamaan
+var restoreNetworkMu sync.Mutex
+
+// EnsureRestoreNetwork membuat network internal (tanpa akses keluar) untuk container restore, lalu memasang
+// container checker sendiri dan container Databasus (RESTORE_NETWORK_ATTACH) ke network tsb. Aman dipanggil
+// berulang: dijalankan saat worker start dan sebelum setiap spawn (container Databasus bisa dibuat ulang).
+// Container restore hanya bisa dijangkau dari network ini, Databasus harus berjalan di Docker host yang sama.
+func (s *DockerService) EnsureRestoreNetwork(ctx context.Context) (string, error) {
+	restoreNetworkMu.Lock()
+	defer restoreNetworkMu.Unlock()
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", fmt.Errorf("failed to create docker client: %v", err)
+	}
+
+	name := os.Getenv("RESTORE_NETWORK")
+	if name == "" {
+		name = defaultRestoreNetwork
+	}
+
+	var attach []string
+	for _, member := range strings.Split(os.Getenv("RESTORE_NETWORK_ATTACH"), ",") {
+		if member = strings.TrimSpace(member); member != "" {
+			attach = append(attach, member)
+		}
+	}
+	if len(attach) == 0 {
+		return "", fmt.Errorf("RESTORE_NETWORK_ATTACH is empty: the Databasus container must be attached to network %s to reach restore containers", name)
+	}
+
+	resource, err := cli.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if client.IsErrNotFound(err) {
+		_, err = cli.NetworkCreate(ctx, name, types.NetworkCreate{
+			Driver:   "bridge",
+			Internal: true,
+			Labels:   map[string]string{"app": "databasus-checker"},
+		})
+		if err != nil && !errdefs.IsConflict(err) {
+			return "", fmt.Errorf("failed to create network %s: %v", name, err)
+		}
+		resource, err = cli.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect network %s: %v", name, err)
+	}
+
+	// Hostname container Docker = short container ID
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to read hostname: %v", err)
+	}
+	members := append([]string{hostname}, attach...)
+
+	for i, member := range members {
+		info, err := cli.ContainerInspect(ctx, member)
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				if i == 0 {
+					return "", fmt.Errorf("checker is not running in a Docker container (hostname %s), it cannot join network %s", member, name)
+				}
+				return "", fmt.Errorf("container %s from RESTORE_NETWORK_ATTACH not found, Databasus could not reach restore containers on network %s", member, name)
+			}
+			return "", fmt.Errorf("failed to inspect container %s: %v", member, err)
+		}
+		if _, attached := resource.Containers[info.ID]; attached {
+			continue
+		}
+		err = cli.NetworkConnect(ctx, resource.ID, info.ID, &network.EndpointSettings{})
+		if err != nil && !isAlreadyAttached(err) {
+			return "", fmt.Errorf("failed to attach %s to network %s: %v", member, name, err)
+		}
+	}
+	return name, nil
+}
+
+// isAlreadyAttached true jika NetworkConnect gagal karena container sudah terpasang ke network
+func isAlreadyAttached(err error) bool {
+	return errdefs.IsConflict(err) || strings.Contains(err.Error(), "already exists")
+}
+
 func (s *DockerService) StopContainer(containerID string) error {
 	ctx := context.Background()
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
@@ -146,3 +279,127 @@ func (s *DockerService) StopContainer(containerID string) error {
 	timeout := 1
 	return cli.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeout})
 }
+
+// RemoveContainer menghapus paksa container (beserta volume) berdasarkan ID atau nama.
+// Container yang sudah tidak ada dianggap sukses.
+func (s *DockerService) RemoveContainer(nameOrID string) error {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+
+	err = cli.ContainerRemove(ctx, nameOrID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+	if err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// SweepOrphanContainers menghapus paksa container restore (beserta volume) yang job-nya sudah tidak RUNNING
+// atau sudah lewat label expires-at (diisi dari ContainerOptions.MaxLifetime). Container tanpa label tsb memakai
+// defaultLifetime; container lama tanpa label sama sekali dikenali dari nama restore_job_<jobID>.
+// runningJobIDs dipanggil setelah daftar container diambil, agar container job yang baru mulai tidak ikut terhapus.
+func (s *DockerService) SweepOrphanContainers(ctx context.Context, defaultLifetime time.Duration, runningJobIDs func() (map[string]bool, error)) ([]string, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("name", containerNamePrefix)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+	if len(containers) == 0 {
+		return nil, nil
+	}
+
+	running, err := runningJobIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, c := range containers {
+		name := ""
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		// Filter name Docker mencocokkan substring, pastikan memang container restore
+		if !strings.HasPrefix(name, containerNamePrefix) {
+			continue
+		}
+		jobID := c.Labels[labelJobID]
+		if jobID == "" {
+			jobID = strings.TrimPrefix(name, containerNamePrefix)
+		}
+
+		expiresAt := time.Unix(c.Created, 0).Add(defaultLifetime)
+		if label, ok := c.Labels[labelExpiresAt]; ok {
+			if t, err := time.Parse(time.RFC3339, label); err == nil {
+				expiresAt = t
+			}
+		}
+		if running[jobID] && time.Now().Before(expiresAt) {
+			continue
+		}
+
+		err := cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			return removed, fmt.Errorf("failed to remove container %s: %v", name, err)
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// ExecInContainer menjalankan command di dalam container (docker exec) dan mengembalikan gabungan
+// stdout + stderr beserta exit code-nya.
+func (s *DockerService) ExecInContainer(ctx context.Context, containerID string, user string, cmd []string, env []string) (string, int, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", -1, err
+	}
+
+	execResp, err := cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		User:         user,
+		Cmd:          cmd,
+		Env:          env,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to create exec: %v", err)
+	}
+
+	attach, err := cli.ContainerExecAttach(ctx, execResp.ID, types.ExecStartCheck{})
+	if err != nil {
+		return "", -1, fmt.Errorf("failed to attach exec: %v", err)
+	}
+	defer attach.Close()
+
+	// Output harus dibaca sampai habis sebelum exit code tersedia
+	var output bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(&output, &output, attach.Reader)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return output.String(), -1, fmt.Errorf("failed to read exec output: %v", err)
+		}
+	case <-ctx.Done():
+		return output.String(), -1, ctx.Err()
+	}
+
+	inspect, err := cli.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return output.String(), -1, fmt.Errorf("failed to inspect exec: %v", err)
+	}
+	return output.String(), inspect.ExitCode, nil
+}
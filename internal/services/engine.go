@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Engine database yang didukung (DatabaseDTO.Type dari Databasus, lowercase)
+const (
+	EnginePostgres = "postgresql"
+	EngineMySQL    = "mysql"
+	EngineMariaDB  = "mariadb"
+	EngineMongoDB  = "mongodb"
+)
+
+// DatabaseEngine menyimpan perbedaan antar engine: image container, kredensial,
+// DSN & driver GORM, serta key payload restore Databasus.
+type DatabaseEngine struct {
+	Name           string
+	DefaultVersion string
+	ImageTemplate  string        // fmt.Sprintf(ImageTemplate, version)
+	ContainerPort  string        // Port di dalam container, format "5432/tcp"
+	StartupTimeout time.Duration // MySQL / MariaDB butuh waktu init lebih lama dari Postgres
+	RestoreKey     string        // Key konfigurasi target di body restore Databasus
+}
+
+var ErrUnsupportedEngine = errors.New("unsupported database type")
+
+var engines = map[string]DatabaseEngine{
+	EnginePostgres: {
+		Name:           EnginePostgres,
+		DefaultVersion: "15",
+		ImageTemplate:  "postgres:%s-alpine",
+		ContainerPort:  "5432/tcp",
+		StartupTimeout: 30 * time.Second,
+		RestoreKey:     "postgresqlDatabase",
+	},
+	EngineMySQL: {
+		Name:           EngineMySQL,
+		DefaultVersion: "8.0",
+		ImageTemplate:  "mysql:%s",
+		ContainerPort:  "3306/tcp",
+		StartupTimeout: 2 * time.Minute,
+		RestoreKey:     "mysqlDatabase",
+	},
+	EngineMariaDB: {
+		Name:           EngineMariaDB,
+		DefaultVersion: "11",
+		ImageTemplate:  "mariadb:%s",
+		ContainerPort:  "3306/tcp",
+		StartupTimeout: 2 * time.Minute,
+		RestoreKey:     "mariadbDatabase",
+	},
+	EngineMongoDB: {
+		Name:           EngineMongoDB,
+		DefaultVersion: "7",
+		ImageTemplate:  "mongo:%s",
+		ContainerPort:  "27017/tcp",
+		StartupTimeout: time.Minute,
+		RestoreKey:     "mongodbDatabase",
+	},
+}
+
+// EngineFor memetakan DatabaseDTO.Type ke engine. Type kosong dianggap PostgreSQL (perilaku lama).
+func EngineFor(dbType string) (DatabaseEngine, error) {
+	name := strings.ToLower(strings.TrimSpace(dbType))
+	switch name {
+	case "", "postgres":
+		name = EnginePostgres
+	}
+	engine, ok := engines[name]
+	if !ok {
+		return DatabaseEngine{}, fmt.Errorf("%w: %q", ErrUnsupportedEngine, dbType)
+	}
+	return engine, nil
+}
+
+func (e DatabaseEngine) IsPostgres() bool {
+	return e.Name == EnginePostgres
+}
+
+// IsMongo true untuk MongoDB: koneksi lewat MongoService, bukan GORM
+func (e DatabaseEngine) IsMongo() bool {
+	return e.Name == EngineMongoDB
+}
+
+func (e DatabaseEngine) Image(version string) string {
+	if version == "" {
+		version = e.DefaultVersion
+	}
+	return fmt.Sprintf(e.ImageTemplate, version)
+}
+
+// AdminUser user yang dipakai checker & Databasus. MySQL / MariaDB memakai root agar restore
+// objek dengan DEFINER, trigger dan routine tidak ditolak.
+func (e DatabaseEngine) AdminUser(generated string) string {
+	if e.Name == EngineMySQL || e.Name == EngineMariaDB {
+		return "root"
+	}
+	return generated
+}
+
+// ContainerEnv environment variable image resmi untuk membuat user & database awal
+func (e DatabaseEngine) ContainerEnv(user, password, dbName string) []string {
+	switch e.Name {
+	case EngineMySQL:
+		return []string{"MYSQL_ROOT_PASSWORD=" + password, "MYSQL_DATABASE=" + dbName}
+	case EngineMariaDB:
+		return []string{"MARIADB_ROOT_PASSWORD=" + password, "MARIADB_DATABASE=" + dbName}
+	case EngineMongoDB:
+		return []string{"MONGO_INITDB_ROOT_USERNAME=" + user, "MONGO_INITDB_ROOT_PASSWORD=" + password, "MONGO_INITDB_DATABASE=" + dbName}
+	default:
+		return []string{"POSTGRES_USER=" + user, "POSTGRES_PASSWORD=" + password, "POSTGRES_DB=" + dbName}
+	}
+}
+
+// Env image resmi yang mengubah kredensial selain yang dibuat ContainerEnv
+var extraCredentialEnv = []string{
+	"MYSQL_RANDOM_ROOT_PASSWORD", "MYSQL_ALLOW_EMPTY_PASSWORD", "MYSQL_ROOT_HOST",
+	"MARIADB_RANDOM_ROOT_PASSWORD", "MARIADB_ALLOW_EMPTY_ROOT_PASSWORD", "MARIADB_ROOT_PASSWORD_HASH", "MARIADB_ROOT_HOST",
+}
+
+// IsCredentialEnv true jika env (key dari "KEY=VALUE") menimpa kredensial / database awal engine mana pun,
+// termasuk varian *_FILE. Env custom seperti ini membuat checker tidak bisa login ke container.
+func IsCredentialEnv(key string) bool {
+	key = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(key)), "_FILE")
+	for _, reserved := range extraCredentialEnv {
+		if key == reserved {
+			return true
+		}
+	}
+	for _, engine := range engines {
+		for _, env := range engine.ContainerEnv("", "", "") {
+			if key == strings.TrimSuffix(env, "=") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Dialector GORM untuk koneksi checker ke DB ephemeral (tidak dipakai untuk MongoDB)
+func (e DatabaseEngine) Dialector(host string, port int, user, password, dbName string) gorm.Dialector {
+	if e.IsPostgres() {
+		return postgres.Open(PostgresDSN(host, port, user, password, dbName))
+	}
+	// multiStatements untuk pre/post-restore script, parseTime untuk freshness check
+	return mysql.Open(fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?multiStatements=true&parseTime=true&loc=UTC",
+		user, password, host, port, dbName))
+}
+
+// PostgresDSN DSN key=value untuk DB ephemeral Postgres (GORM maupun koneksi pgx langsung)
+func PostgresDSN(host string, port int, user, password, dbName string) string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=UTC",
+		host, user, password, dbName, port)
+}
+
+// RestoreTarget konfigurasi DB tujuan untuk body restore Databasus
+func (e DatabaseEngine) RestoreTarget(host string, port int, user, password, dbName string) map[string]interface{} {
+	target := map[string]interface{}{
+		"host":     host,
+		"port":     port,
+		"username": user,
+		"password": password,
+		"database": dbName,
+	}
+	if e.IsPostgres() {
+		target["sslmode"] = "disable"
+	}
+	if e.IsMongo() {
+		target["authDatabase"] = "admin" // User root dibuat di database admin oleh image mongo
+	}
+	return target
+}
+
+// QuoteIdent meng-quote identifier sesuai dialek engine
+func (e DatabaseEngine) QuoteIdent(name string) string {
+	if e.IsPostgres() {
+		return quoteIdent(name)
+	}
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
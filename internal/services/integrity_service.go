@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type IntegrityService struct {
+	DockerService DockerService
+}
+
+// Batas jumlah baris temuan yang disimpan ke job
+const maxIntegrityFindings = 200
+
+// Daftar index B-tree user yang bisa dicek dengan bt_index_check
+const btreeIndexesQuery = `
+SELECT quote_ident(n.nspname) || '.' || quote_ident(c.relname)
+FROM pg_index i
+JOIN pg_class c ON c.oid = i.indexrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+JOIN pg_am am ON am.oid = c.relam
+WHERE am.amname = 'btree'
+  AND i.indisvalid AND i.indisready
+  AND c.relpersistence <> 't'
+  AND n.nspname NOT IN ('pg_catalog', 'information_schema', 'pg_toast')
+ORDER BY 1`
+
+// DeepCheck memeriksa konsistensi fisik DB hasil restore.
+// Postgres 14+ memakai pg_amcheck di dalam container (heap + B-tree index),
+// versi lama memakai fungsi bt_index_check dari extension amcheck (index saja).
+// Return daftar temuan korupsi; kosong berarti bersih.
+func (s *IntegrityService) DeepCheck(ctx context.Context, db *gorm.DB, eph *EphemeralDB) ([]string, string, error) {
+	if majorVersion(eph.Version) >= 14 {
+		findings, err := s.runPgAmcheck(ctx, eph)
+		return findings, "pg_amcheck", err
+	}
+	findings, err := s.runBtIndexCheck(ctx, db)
+	return findings, "amcheck bt_index_check", err
+}
+
+// Exit code pg_amcheck: 0 = bersih, 2 = korupsi ditemukan, selain itu error operasional (koneksi, auth, install extension)
+const pgAmcheckCorruptionExitCode = 2
+
+// runPgAmcheck dijalankan sebagai user default container (image custom bisa memakai user lain / numerik),
+// login ke database memakai user & password ephemeral.
+func (s *IntegrityService) runPgAmcheck(ctx context.Context, eph *EphemeralDB) ([]string, error) {
+	cmd := []string{
+		"pg_amcheck",
+		"--username", eph.User,
+		"--database", eph.DBName,
+		"--install-missing",
+		"--heapallindexed",
+		"--no-strict-names",
+	}
+	output, exitCode, err := s.DockerService.ExecInContainer(ctx, eph.ContainerID, "", cmd, []string{"PGPASSWORD=" + eph.Password})
+	if err != nil {
+		return nil, err
+	}
+	if exitCode == 0 {
+		return nil, nil
+	}
+	if exitCode != pgAmcheckCorruptionExitCode {
+		return nil, fmt.Errorf("pg_amcheck exited with code %d: %s", exitCode, strings.TrimSpace(output))
+	}
+
+	var findings []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if len(findings) >= maxIntegrityFindings {
+			findings = append(findings, "... (truncated)")
+			break
+		}
+		findings = append(findings, line)
+	}
+	if len(findings) == 0 {
+		return nil, fmt.Errorf("pg_amcheck exited with code %d", exitCode)
+	}
+	return findings, nil
+}
+
+func (s *IntegrityService) runBtIndexCheck(ctx context.Context, db *gorm.DB) ([]string, error) {
+	tx := db.WithContext(ctx)
+	if err := tx.Exec("CREATE EXTENSION IF NOT EXISTS amcheck").Error; err != nil {
+		return nil, fmt.Errorf("failed to install amcheck: %v", err)
+	}
+
+	var indexes []string
+	if err := tx.Raw(btreeIndexesQuery).Scan(&indexes).Error; err != nil {
+		return nil, err
+	}
+
+	// bt_index_check(regclass, heapallindexed) baru ada di Postgres 11, versi 10 hanya punya bentuk satu argumen
+	var versionNum int
+	if err := tx.Raw("SELECT current_setting('server_version_num')::int").Scan(&versionNum).Error; err != nil {
+		return nil, err
+	}
+	checkQuery := "SELECT bt_index_check(?::regclass, true)"
+	if versionNum < 110000 {
+		checkQuery = "SELECT bt_index_check(?::regclass)"
+	}
+
+	var findings []string
+	for _, index := range indexes {
+		if ctx.Err() != nil {
+			return findings, ctx.Err()
+		}
+		if err := tx.Exec(checkQuery, index).Error; err != nil {
+			findings = append(findings, fmt.Sprintf("btree index %s: %v", index, err))
+			if len(findings) >= maxIntegrityFindings {
+				break
+			}
+		}
+	}
+	return findings, nil
+}
+
+// majorVersion mengambil angka mayor dari string versi seperti "15", "16.2" atau "9.6"
+func majorVersion(version string) int {
+	major := version
+	if i := strings.IndexAny(version, ".-"); i >= 0 {
+		major = version[:i]
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(major))
+	return n
+}
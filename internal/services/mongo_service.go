@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"databasus-checker/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+)
+
+// MongoService padanan ValidationService untuk MongoDB. Script & check ditulis sebagai (Extended) JSON.
+type MongoService struct{}
+
+// mongoQuery format Query pada ValidationCheck untuk MongoDB, contoh:
+// {"collection": "orders", "filter": {"status": "paid"}, "field": "total", "sort": {"createdAt": -1}}
+type mongoQuery struct {
+	Collection string          `json:"collection"`
+	Filter     json.RawMessage `json:"filter"`
+	Sort       json.RawMessage `json:"sort"`
+	Field      string          `json:"field"` // Nilai untuk SCALAR_EQ / REGEX, default field pertama selain _id
+}
+
+// Connect membuka koneksi ke container mongo dan memastikan server sudah menerima perintah
+func (s *MongoService) Connect(ctx context.Context, eph *EphemeralDB) (*mongo.Client, error) {
+	uri := fmt.Sprintf("mongodb://%s:%s@%s:%d/?authSource=admin&directConnection=true",
+		url.QueryEscape(eph.User), url.QueryEscape(eph.Password), eph.Host, eph.Port)
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri).SetConnectTimeout(5 * time.Second))
+	if err != nil {
+		return nil, err
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx, readpref.Primary()); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+	return client, nil
+}
+
+// RunCommand menjalankan satu command document (mis. {"createRole": ...}) dan mengembalikan hasilnya sebagai satu baris
+func (s *MongoService) RunCommand(ctx context.Context, db *mongo.Database, name, script string) (*models.QueryResult, error) {
+	var command bson.D
+	if err := bson.UnmarshalExtJSON([]byte(script), false, &command); err != nil {
+		return nil, fmt.Errorf("invalid command JSON: %v", err)
+	}
+
+	var response bson.D
+	if err := db.RunCommand(ctx, command).Decode(&response); err != nil {
+		return nil, err
+	}
+	return documentsToResult(name, []bson.D{response}, 1, ""), nil
+}
+
+// RunChecks menjalankan assertion sebagai query MongoDB (count + find) ke DB hasil restore
+func (s *MongoService) RunChecks(ctx context.Context, db *mongo.Database, checks []models.ValidationCheck) (models.CheckResults, models.QueryResults) {
+	results := make(models.CheckResults, 0, len(checks))
+	captured := make(models.QueryResults, 0, len(checks))
+	for _, check := range checks {
+		queryResult, err := s.find(ctx, db, check.Name, check.Query)
+		if err != nil {
+			results = append(results, models.CheckResult{Name: check.Name, Message: fmt.Sprintf("query error: %v", err)})
+			continue
+		}
+		results = append(results, evaluateCheck(check, queryResult))
+		captured = append(captured, *queryResult)
+	}
+	return results, captured
+}
+
+func (s *MongoService) find(ctx context.Context, db *mongo.Database, name, query string) (*models.QueryResult, error) {
+	var q mongoQuery
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		return nil, fmt.Errorf("invalid query JSON: %v", err)
+	}
+	if q.Collection == "" {
+		return nil, errors.New(`query must contain "collection"`)
+	}
+
+	filter := bson.D{}
+	if len(q.Filter) > 0 {
+		if err := bson.UnmarshalExtJSON(q.Filter, false, &filter); err != nil {
+			return nil, fmt.Errorf("invalid filter: %v", err)
+		}
+	}
+	findOpts := options.Find().SetLimit(maxCapturedRows)
+	if len(q.Sort) > 0 {
+		var sort bson.D
+		if err := bson.UnmarshalExtJSON(q.Sort, false, &sort); err != nil {
+			return nil, fmt.Errorf("invalid sort: %v", err)
+		}
+		findOpts.SetSort(sort)
+	}
+
+	collection := db.Collection(q.Collection)
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []bson.D
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return documentsToResult(name, docs, int(count), q.Field), nil
+}
+
+// NewestTimestamp padanan ValidationService.NewestTimestamp: nilai field terbesar di sebuah collection
+func (s *MongoService) NewestTimestamp(ctx context.Context, db *mongo.Database, collection, field string) (*time.Time, error) {
+	filter := bson.D{{Key: field, Value: bson.D{{Key: "$exists", Value: true}}}}
+	opts := options.FindOne().SetSort(bson.D{{Key: field, Value: -1}})
+
+	var doc bson.M
+	err := db.Collection(collection).FindOne(ctx, filter, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := doc[field].(type) {
+	case bson.DateTime:
+		t := v.Time()
+		return &t, nil
+	case bson.Timestamp:
+		t := time.Unix(int64(v.T), 0)
+		return &t, nil
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("field %s is not a date: %q", field, v)
+		}
+		return &t, nil
+	default:
+		return nil, fmt.Errorf("field %s is not a date (%T)", field, v)
+	}
+}
+
+// documentsToResult mengubah dokumen menjadi tabel. Kolom diambil dari urutan field yang muncul,
+// field pilihan (jika ada) dipindah ke kolom pertama agar dipakai sebagai nilai tunggal check.
+func documentsToResult(name string, docs []bson.D, rowCount int, field string) *models.QueryResult {
+	var columns []string
+	seen := map[string]bool{}
+	if field != "" {
+		columns = append(columns, field)
+		seen[field] = true
+	}
+	for _, doc := range docs {
+		for _, elem := range doc {
+			if !seen[elem.Key] {
+				seen[elem.Key] = true
+				columns = append(columns, elem.Key)
+			}
+		}
+	}
+	// Tanpa field pilihan, _id tidak dijadikan nilai tunggal
+	if field == "" && len(columns) > 1 && columns[0] == "_id" {
+		columns = append(columns[1:], "_id")
+	}
+
+	result := &models.QueryResult{Name: name, Columns: columns, Rows: [][]string{}, RowCount: rowCount}
+	for _, doc := range docs {
+		values := make(map[string]interface{}, len(doc))
+		for _, elem := range doc {
+			values[elem.Key] = elem.Value
+		}
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			if v, ok := values[col]; ok {
+				row[i] = formatMongoValue(v)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	result.Truncated = rowCount > len(result.Rows)
+	return result
+}
+
+func formatMongoValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return val
+	case bson.ObjectID:
+		return val.Hex()
+	case bson.DateTime:
+		return val.Time().UTC().Format(time.RFC3339)
+	case bson.D, bson.M:
+		out, err := bson.MarshalExtJSON(val, false, false)
+		if err != nil {
+			return fmt.Sprint(val)
+		}
+		return string(out)
+	case bson.A:
+		parts := make([]string, len(val))
+		for i, item := range val {
+			parts[i] = formatMongoValue(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	default:
+		return fmt.Sprint(val)
+	}
+}
@@ -4,15 +4,17 @@ import (
 	"databasus-checker/internal/database"
 	"databasus-checker/internal/models"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type QueueService struct{}
 
-func (s *QueueService) Enqueue(testID string) (*models.Job, error) {
+func (s *QueueService) Enqueue(testID string, trigger string) (*models.Job, error) {
 	parsedID, err := uuid.Parse(testID)
 	if err != nil {
 		return nil, errors.New("invalid test id format")
@@ -24,20 +26,52 @@ func (s *QueueService) Enqueue(testID string) (*models.Job, error) {
 		return nil, errors.New("restore test config not found")
 	}
 
-	// Cek duplikasi job pending
+	// Cek duplikasi job pending. Retry yang masih menunggu backoff (run_after di masa depan) tidak dihitung
+	now := time.Now()
 	var count int64
 	database.DB.Model(&models.Job{}).
-		Where("restore_test_config_id = ? AND status IN ('PENDING', 'RUNNING')", parsedID).
+		Where("restore_test_config_id = ? AND (status = 'RUNNING' OR (status = 'PENDING' AND (run_after IS NULL OR run_after <= ?)))", parsedID, now).
 		Count(&count)
 
 	if count > 0 {
 		return nil, errors.New("this test is already queued or running")
 	}
 
+	// Retry yang sedang backoff dimajukan agar jalan sekarang (attempt tetap terhitung), bukan dibuat job baru
+	var waiting models.Job
+	err = database.DB.Where("restore_test_config_id = ? AND status = 'PENDING' AND run_after > ?", parsedID, now).
+		Order("run_after asc").Limit(1).Find(&waiting).Error
+	if err != nil {
+		return nil, err
+	}
+	if waiting.ID != uuid.Nil {
+		priority := waiting.Priority
+		if p := models.PriorityFor(trigger); p > priority {
+			priority = p
+		}
+		result := database.DB.Model(&models.Job{}).
+			Where("id = ? AND status = 'PENDING'", waiting.ID).
+			Updates(map[string]interface{}{"run_after": now, "priority": priority})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Retry baru saja diambil worker
+			return nil, errors.New("this test is already queued or running")
+		}
+		waiting.RunAfter = &now
+		waiting.Priority = priority
+		return &waiting, nil
+	}
+
 	job := models.Job{
 		RestoreTestConfigID: &parsedID,     // Pointer
 		TestSnapshotName:    config.Name,   // Snapshot Nama
+		WorkspaceID:         config.WorkspaceID,
 		Status:              "PENDING",
+		Attempt:             1,
+		Trigger:             trigger,
+		Priority:            models.PriorityFor(trigger),
 	}
 
 	if err := database.DB.Create(&job).Error; err != nil {
@@ -51,8 +85,15 @@ func (s *QueueService) GetPendingJob() (*models.Job, error) {
 	var job models.Job
 
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		result := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
-			Where("status = ?", "PENDING").
+		// GORM v2 mengabaikan "gorm:query_option", pakai clause.Locking agar worker paralel tidak ambil job yang sama
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND (run_after IS NULL OR run_after <= ?)", "PENDING", time.Now()).
+			// 1. Prioritas tertinggi dulu (manual > backup baru > jadwal)
+			// 2. Fairness: workspace dengan job RUNNING paling sedikit, lalu yang paling lama tidak dilayani
+			// 3. FIFO
+			Order("priority desc").
+			Order("(SELECT count(*) FROM jobs AS running WHERE running.status = 'RUNNING' AND running.workspace_id = jobs.workspace_id) asc").
+			Order("(SELECT max(served.started_at) FROM jobs AS served WHERE served.workspace_id = jobs.workspace_id) asc nulls first").
 			Order("created_at asc").
 			First(&job)
 
@@ -62,14 +103,16 @@ func (s *QueueService) GetPendingJob() (*models.Job, error) {
 
 		now := time.Now()
 		if err := tx.Model(&models.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
-			"status":     "RUNNING",
-			"started_at": now,
+			"status":       "RUNNING",
+			"started_at":   now,
+			"heartbeat_at": now,
 		}).Error; err != nil {
 			return err
 		}
 		
 		job.Status = "RUNNING"
 		job.StartedAt = &now
+		job.HeartbeatAt = &now
 		return nil
 	})
 
@@ -89,24 +132,307 @@ func (s *QueueService) GetPendingJob() (*models.Job, error) {
 	return &fullJob, nil
 }
 
+func (s *QueueService) GetJob(jobID string) (*models.Job, error) {
+	var job models.Job
+	if err := database.DB.First(&job, "id = ?", jobID).Error; err != nil {
+		return nil, errors.New("job not found")
+	}
+	return &job, nil
+}
+
+// GetJobWithSteps sama seperti GetJob, sekaligus memuat timeline step
+func (s *QueueService) GetJobWithSteps(jobID string) (*models.Job, error) {
+	var job models.Job
+	err := database.DB.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).First(&job, "id = ?", jobID).Error
+	if err != nil {
+		return nil, errors.New("job not found")
+	}
+	return &job, nil
+}
+
+// CancelPendingJob membatalkan job yang belum diambil worker.
+// Return false jika job sudah tidak PENDING (misal baru saja diambil worker).
+func (s *QueueService) CancelPendingJob(jobID string) (bool, error) {
+	now := time.Now()
+	result := database.DB.Model(&models.Job{}).
+		Where("id = ? AND status = ?", jobID, "PENDING").
+		Updates(map[string]interface{}{
+			"status":      "CANCELLED",
+			"finished_at": now,
+			"log_output":  fmt.Sprintf("[%s] Job cancelled by user before it started.\n", now.Format("15:04:05")),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CancelRunningJob menandai job RUNNING sebagai CANCELLED langsung di DB, untuk job yang dikerjakan
+// instance lain. Worker pemilik job melihat perubahan status lewat heartbeat lalu menghentikan job.
+// Return false jika job sudah tidak RUNNING.
+func (s *QueueService) CancelRunningJob(jobID string) (bool, error) {
+	now := time.Now()
+	line := fmt.Sprintf("[%s] Job cancelled by user.\n", now.Format("15:04:05"))
+	result := database.DB.Model(&models.Job{}).
+		Where("id = ? AND status = ?", jobID, "RUNNING").
+		Updates(map[string]interface{}{
+			"status":      "CANCELLED",
+			"finished_at": now,
+			"log_output":  gorm.Expr("COALESCE(log_output, '') || ?", line),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetJobStatus mengambil status job saja (dipakai worker untuk mendeteksi pembatalan dari instance lain)
+func (s *QueueService) GetJobStatus(jobID uuid.UUID) (string, error) {
+	var status string
+	err := database.DB.Model(&models.Job{}).Where("id = ?", jobID).Pluck("status", &status).Error
+	return status, err
+}
+
+// ScheduleRetry membuat job baru (attempt berikutnya) dengan exponential backoff sesuai retry policy test.
+// Return nil jika attempt sudah habis atau config test sudah dihapus.
+func (s *QueueService) ScheduleRetry(job *models.Job) (*models.Job, error) {
+	if job.RestoreTestConfigID == nil {
+		return nil, nil
+	}
+
+	var config models.RestoreTestConfig
+	if err := database.DB.First(&config, "id = ?", job.RestoreTestConfigID).Error; err != nil {
+		return nil, nil
+	}
+
+	attempt := job.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt >= config.MaxAttempts {
+		return nil, nil
+	}
+
+	backoff := time.Duration(config.RetryBackoffSeconds) * time.Second
+	if backoff <= 0 {
+		backoff = 60 * time.Second
+	}
+	delay := backoff << (attempt - 1)
+	if delay > 24*time.Hour || delay <= 0 {
+		delay = 24 * time.Hour
+	}
+	runAfter := time.Now().Add(delay)
+
+	originalID := job.ID
+	if job.OriginalJobID != nil {
+		originalID = *job.OriginalJobID
+	}
+
+	retry := models.Job{
+		RestoreTestConfigID: job.RestoreTestConfigID,
+		TestSnapshotName:    job.TestSnapshotName,
+		WorkspaceID:         job.WorkspaceID,
+		Status:              "PENDING",
+		Attempt:             attempt + 1,
+		Trigger:             job.Trigger,
+		Priority:            job.Priority,
+		OriginalJobID:       &originalID,
+		RunAfter:            &runAfter,
+	}
+	if err := database.DB.Create(&retry).Error; err != nil {
+		return nil, err
+	}
+	return &retry, nil
+}
+
+// AppendLog menambahkan baris log ke job (untuk live tail). Worker memanggilnya per batch, bukan per baris
+func (s *QueueService) AppendLog(jobID uuid.UUID, line string) error {
+	return database.DB.Model(&models.Job{}).
+		Where("id = ?", jobID).
+		Update("log_output", gorm.Expr("COALESCE(log_output, '') || ?", line)).Error
+}
+
+// LogChunk potongan log job untuk live tail
+type LogChunk struct {
+	Status    string
+	LogLength int    // Panjang log_output (karakter)
+	Chunk     string // log_output mulai dari offset
+}
+
+// GetLogChunk hanya mengambil status dan log setelah offset (karakter), bukan seluruh baris job
+func (s *QueueService) GetLogChunk(jobID string, offset int) (*LogChunk, error) {
+	var chunk LogChunk
+	result := database.DB.Model(&models.Job{}).
+		Select("status, length(COALESCE(log_output, '')) AS log_length, substring(COALESCE(log_output, '') from ?) AS chunk", offset+1).
+		Where("id = ?", jobID).
+		Scan(&chunk)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("job not found")
+	}
+	return &chunk, nil
+}
+
+// Heartbeat menandakan job masih dikerjakan worker yang hidup
+func (s *QueueService) Heartbeat(jobID uuid.UUID) error {
+	return database.DB.Model(&models.Job{}).
+		Where("id = ? AND status = ?", jobID, "RUNNING").
+		Update("heartbeat_at", time.Now()).Error
+}
+
+// GetExpiredJobs mengambil job RUNNING yang heartbeat-nya sudah lewat timeout (worker crash / restart)
+func (s *QueueService) GetExpiredJobs(timeout time.Duration) ([]models.Job, error) {
+	var jobs []models.Job
+	deadline := time.Now().Add(-timeout)
+	err := database.DB.Where("status = ? AND COALESCE(heartbeat_at, started_at, created_at) < ?", "RUNNING", deadline).
+		Find(&jobs).Error
+	return jobs, err
+}
+
+// MarkAbandoned menandai job yang ditinggal worker sebagai FAILED.
+// Hanya berhasil jika job masih RUNNING (tidak menimpa hasil worker yang ternyata selesai).
+func (s *QueueService) MarkAbandoned(job *models.Job, reason string) (bool, error) {
+	now := time.Now()
+	line := fmt.Sprintf("[%s] ERROR: %s\n", now.Format("15:04:05"), reason)
+	updates := map[string]interface{}{
+		"status":      "FAILED",
+		"finished_at": now,
+		"log_output":  job.LogOutput + line,
+	}
+	if job.StartedAt != nil {
+		updates["duration_seconds"] = int(now.Sub(*job.StartedAt).Seconds())
+	}
+
+	result := database.DB.Model(&models.Job{}).
+		Where("id = ? AND status = ?", job.ID, "RUNNING").
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetRunningJobIDs mengambil ID semua job yang sedang RUNNING (dipakai sweeper container)
+func (s *QueueService) GetRunningJobIDs() (map[string]bool, error) {
+	var ids []string
+	if err := database.DB.Model(&models.Job{}).Where("status = ?", "RUNNING").Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	running := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		running[id] = true
+	}
+	return running, nil
+}
+
 func (s *QueueService) UpdateJob(job *models.Job) {
-	database.DB.Model(job).Select("status", "finished_at", "duration_seconds", "log_output", "last_processed_backup_id").Updates(job)
+	database.DB.Model(job).Select("status", "finished_at", "duration_seconds", "restore_duration_seconds", "log_output", "last_processed_backup_id", "backup_sha256", "check_results", "query_results",
+		"schema_fingerprint", "schema_snapshot", "schema_diff", "integrity_findings").Updates(job)
+}
+
+// GetPreviousSchemaJob mengambil job terakhir dari test yang sama yang sudah punya schema fingerprint
+func (s *QueueService) GetPreviousSchemaJob(configID uuid.UUID, excludeJobID uuid.UUID) (*models.Job, error) {
+	var job models.Job
+	err := database.DB.Select("id", "schema_fingerprint", "schema_snapshot").
+		Where("restore_test_config_id = ? AND id <> ? AND schema_fingerprint <> ''", configID, excludeJobID).
+		Order("created_at desc").
+		Limit(1).
+		Find(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	if job.ID == uuid.Nil {
+		return nil, nil
+	}
+	return &job, nil
 }
 
 func (s *QueueService) GetActiveJobs() ([]models.Job, error) {
 	var jobs []models.Job
 	// Tidak perlu Preload Config lagi karena kita pakai Snapshot Name untuk display
 	err := database.DB.Where("status IN ?", []string{"PENDING", "RUNNING"}).
-		Order("created_at asc").
+		Order("priority desc, created_at asc").
 		Find(&jobs).Error
 	return jobs, err
 }
 
 func (s *QueueService) GetJobHistory(limit int) ([]models.Job, error) {
 	var jobs []models.Job
-	err := database.DB.Where("status IN ?", []string{"SUCCESS", "FAILED"}).
+	err := database.DB.Where("status IN ?", []string{"SUCCESS", "WARNING", "FAILED", "CANCELLED"}).
 		Order("finished_at desc").
 		Limit(limit).
 		Find(&jobs).Error
 	return jobs, err
 }
+
+// --- Job Steps (Timeline) ---
+
+func (s *QueueService) StartStep(jobID uuid.UUID, name string, position int) (*models.JobStep, error) {
+	step := models.JobStep{
+		JobID:     jobID,
+		Name:      name,
+		Position:  position,
+		Status:    "RUNNING",
+		StartedAt: time.Now(),
+	}
+	if err := database.DB.Create(&step).Error; err != nil {
+		return nil, err
+	}
+	return &step, nil
+}
+
+func (s *QueueService) FinishStep(step *models.JobStep, status string, errorMessage string) {
+	if step == nil {
+		return
+	}
+	now := time.Now()
+	step.Status = status
+	step.FinishedAt = &now
+	step.DurationMs = now.Sub(step.StartedAt).Milliseconds()
+	step.ErrorMessage = errorMessage
+	database.DB.Model(step).Select("status", "finished_at", "duration_ms", "error_message").Updates(step)
+}
+
+func (s *QueueService) SkipStep(jobID uuid.UUID, name string, position int) {
+	now := time.Now()
+	database.DB.Create(&models.JobStep{
+		JobID:      jobID,
+		Name:       name,
+		Position:   position,
+		Status:     "SKIPPED",
+		StartedAt:  now,
+		FinishedAt: &now,
+	})
+}
+
+// StepStat ringkasan performa per fase untuk semua test
+type StepStat struct {
+	Name          string
+	Runs          int
+	Failures      int
+	AvgDurationMs float64
+	MaxDurationMs int64
+	AvgPercent    int // Lebar bar relatif terhadap fase paling lambat
+}
+
+func (s *QueueService) GetStepStats(since time.Time) ([]StepStat, error) {
+	var stats []StepStat
+	err := database.DB.Model(&models.JobStep{}).
+		Select("name, count(*) AS runs, count(*) FILTER (WHERE status = 'FAILED') AS failures, "+
+			"avg(duration_ms) AS avg_duration_ms, max(duration_ms) AS max_duration_ms").
+		Where("started_at >= ? AND status NOT IN ?", since, []string{"SKIPPED", "RUNNING"}).
+		Group("name").
+		Order("min(position) asc").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var slowest float64
+	for _, st := range stats {
+		if st.AvgDurationMs > slowest {
+			slowest = st.AvgDurationMs
+		}
+	}
+	for i := range stats {
+		if slowest > 0 {
+			stats[i].AvgPercent = int(stats[i].AvgDurationMs / slowest * 100)
+		}
+	}
+	return stats, nil
+}
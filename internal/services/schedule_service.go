@@ -0,0 +1,38 @@
+package services
+
+import (
+	"databasus-checker/internal/database"
+	"databasus-checker/internal/models"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+type ScheduleService struct{}
+
+// Location resolve timezone test, fallback ke AppSettings.AppTimezone lalu UTC
+func (s *ScheduleService) Location(timezone string) *time.Location {
+	if timezone == "" {
+		timezone = models.GetSettings(database.DB).AppTimezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// NextRun menghitung jadwal berikutnya setelah 'after' berdasarkan cron expression (5 field standar)
+func (s *ScheduleService) NextRun(expression string, timezone string, after time.Time) (time.Time, error) {
+	schedule, err := cron.ParseStandard(expression)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression: %v", err)
+	}
+
+	next := schedule.Next(after.In(s.Location(timezone)))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never fires", expression)
+	}
+	return next, nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"databasus-checker/internal/models"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type SchemaService struct{}
+
+// Snapshot schema dalam bentuk satu baris per objek agar mudah di-diff antar run.
+// Nama constraint/index ikut dicatat, OID dan urutan fisik kolom tidak.
+const schemaSnapshotQuery = `
+WITH ns AS (
+  SELECT oid, nspname FROM pg_namespace
+  WHERE nspname NOT IN ('pg_catalog', 'information_schema', 'pg_toast')
+    AND nspname NOT LIKE 'pg_temp%' AND nspname NOT LIKE 'pg_toast_temp%'
+)
+SELECT 'table ' || ns.nspname || '.' || c.relname
+FROM pg_class c JOIN ns ON ns.oid = c.relnamespace
+WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f')
+UNION ALL
+SELECT 'column ' || ns.nspname || '.' || c.relname || '.' || a.attname || ' ' || format_type(a.atttypid, a.atttypmod)
+       || CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END
+FROM pg_attribute a
+JOIN pg_class c ON c.oid = a.attrelid
+JOIN ns ON ns.oid = c.relnamespace
+WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f') AND a.attnum > 0 AND NOT a.attisdropped
+UNION ALL
+SELECT 'index ' || schemaname || '.' || indexname || ': ' || indexdef
+FROM pg_indexes
+WHERE schemaname IN (SELECT nspname FROM ns)
+UNION ALL
+SELECT 'constraint ' || ns.nspname || '.' || c.relname || '.' || con.conname || ': ' || pg_get_constraintdef(con.oid)
+FROM pg_constraint con
+JOIN pg_class c ON c.oid = con.conrelid
+JOIN ns ON ns.oid = c.relnamespace
+UNION ALL
+SELECT 'function ' || ns.nspname || '.' || p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')'
+       || COALESCE(' returns ' || pg_get_function_result(p.oid), '')
+FROM pg_proc p
+JOIN ns ON ns.oid = p.pronamespace`
+
+// Snapshot mengambil daftar objek schema (tabel, kolom, index, constraint, function) yang sudah diurutkan
+func (s *SchemaService) Snapshot(ctx context.Context, db *gorm.DB) ([]string, error) {
+	var lines []string
+	if err := db.WithContext(ctx).Raw(schemaSnapshotQuery).Scan(&lines).Error; err != nil {
+		return nil, err
+	}
+	sort.Strings(lines)
+	return lines, nil
+}
+
+// Fingerprint sha256 dari snapshot. Snapshot harus sudah diurutkan (lihat Snapshot)
+func (s *SchemaService) Fingerprint(snapshot []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(snapshot, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Diff membandingkan snapshot job sebelumnya dengan snapshot sekarang
+func (s *SchemaService) Diff(previous *models.Job, current []string) models.SchemaDiff {
+	removed, added := diffStrings(previous.SchemaSnapshot, current)
+	return models.SchemaDiff{
+		PreviousJobID:       previous.ID.String(),
+		PreviousFingerprint: previous.SchemaFingerprint,
+		Added:               added,
+		Removed:             removed,
+	}
+}
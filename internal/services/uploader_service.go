@@ -2,7 +2,10 @@ package services
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
 	"databasus-checker/internal/models"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -20,10 +23,37 @@ import (
 
 type UploaderService struct{}
 
-func (s *UploaderService) UploadToStorage(storage models.StorageConfig, localFilePath string, remoteFileName string) error {
+// FileChecksum checksum file backup lokal (hex). MD5 hanya dipakai untuk mencocokkan ETag S3.
+type FileChecksum struct {
+	SHA256 string
+	MD5    string
+}
+
+// ComputeChecksum menghitung SHA-256 dan MD5 file dalam satu kali baca
+func (s *UploaderService) ComputeChecksum(localFilePath string) (*FileChecksum, error) {
 	file, err := os.Open(localFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %v", err)
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	sha := sha256.New()
+	md := md5.New()
+	if _, err := io.Copy(io.MultiWriter(sha, md), file); err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return &FileChecksum{
+		SHA256: hex.EncodeToString(sha.Sum(nil)),
+		MD5:    hex.EncodeToString(md.Sum(nil)),
+	}, nil
+}
+
+// UploadToStorage mengupload file lalu memverifikasi salinan remote terhadap checksum lokal.
+// Return cara verifikasi yang dipakai (untuk log). Checksum yang tidak cocok dianggap upload gagal.
+func (s *UploaderService) UploadToStorage(storage models.StorageConfig, localFilePath string, remoteFileName string, checksum *FileChecksum) (string, error) {
+	file, err := os.Open(localFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %v", err)
 	}
 	defer file.Close()
 
@@ -34,18 +64,31 @@ func (s *UploaderService) UploadToStorage(storage models.StorageConfig, localFil
 
 	switch storage.Type {
 	case "S3":
-		return s.uploadS3(cfg, file, remoteFileName)
+		return s.uploadS3(cfg, file, remoteFileName, checksum)
 	case "FTP":
-		return s.uploadFTP(cfg, file, remoteFileName)
+		return s.uploadFTP(cfg, file, remoteFileName, checksum)
 	case "SFTP":
-		return s.uploadSFTP(cfg, file, remoteFileName)
+		return s.uploadSFTP(cfg, file, remoteFileName, checksum)
 	default:
-		return fmt.Errorf("storage type %s not implemented yet", storage.Type)
+		return "", fmt.Errorf("storage type %s not implemented yet", storage.Type)
 	}
 }
 
+// verifyReadBack membaca ulang salinan remote dan membandingkan SHA-256-nya
+func verifyReadBack(remote io.Reader, checksum *FileChecksum) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, remote); err != nil {
+		return "", fmt.Errorf("failed to read back uploaded file: %v", err)
+	}
+	actual := hex.EncodeToString(h.Sum(nil))
+	if actual != checksum.SHA256 {
+		return "", fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", checksum.SHA256, actual)
+	}
+	return "read-back SHA-256", nil
+}
+
 // --- S3 Implementation ---
-func (s *UploaderService) uploadS3(cfg map[string]interface{}, file *os.File, objectName string) error {
+func (s *UploaderService) uploadS3(cfg map[string]interface{}, file *os.File, objectName string, checksum *FileChecksum) (string, error) {
 	endpoint, _ := cfg["endpoint"].(string)
 	accessKey, _ := cfg["access_key"].(string)
 	secretKey, _ := cfg["secret_key"].(string)
@@ -66,7 +109,7 @@ func (s *UploaderService) uploadS3(cfg map[string]interface{}, file *os.File, ob
 		Region: region,
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// Logic Penggabungan Prefix + Filename
@@ -81,18 +124,34 @@ func (s *UploaderService) uploadS3(cfg map[string]interface{}, file *os.File, ob
 	// Upload
 	info, err := file.Stat()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// Upload dengan finalObjectName (Prefix + Nama File)
-	_, err = minioClient.PutObject(context.Background(), bucket, finalObjectName, file, info.Size(), minio.PutObjectOptions{
+	uploadInfo, err := minioClient.PutObject(context.Background(), bucket, finalObjectName, file, info.Size(), minio.PutObjectOptions{
 		ContentType: "application/octet-stream",
 	})
-	return err
+	if err != nil {
+		return "", err
+	}
+
+	// ETag upload single-part biasanya = MD5 isi file. Multipart ("<hash>-<parts>") dan SSE-KMS / SSE-C
+	// (ETag bukan MD5) diverifikasi dengan membaca ulang object (sha256)
+	etag := strings.Trim(uploadInfo.ETag, `"`)
+	if strings.EqualFold(etag, checksum.MD5) {
+		return "ETag (MD5)", nil
+	}
+
+	object, err := minioClient.GetObject(context.Background(), bucket, finalObjectName, minio.GetObjectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to read back uploaded object: %v", err)
+	}
+	defer object.Close()
+	return verifyReadBack(object, checksum)
 }
 
 // --- FTP Implementation ---
-func (s *UploaderService) uploadFTP(cfg map[string]interface{}, file io.Reader, fileName string) error {
+func (s *UploaderService) uploadFTP(cfg map[string]interface{}, file io.Reader, fileName string, checksum *FileChecksum) (string, error) {
 	host, _ := cfg["host"].(string)
 	port := "21"
 	if p, ok := cfg["port"].(float64); ok {
@@ -107,12 +166,12 @@ func (s *UploaderService) uploadFTP(cfg map[string]interface{}, file io.Reader,
 
 	c, err := ftp.Dial(fmt.Sprintf("%s:%s", host, port), ftp.DialWithTimeout(10*time.Second))
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer c.Quit()
 
 	if err := c.Login(user, pass); err != nil {
-		return err
+		return "", err
 	}
 
 	// Change dir if needed (Prefix logic untuk FTP)
@@ -120,15 +179,25 @@ func (s *UploaderService) uploadFTP(cfg map[string]interface{}, file io.Reader,
 		// Coba buat directory jika belum ada (Opsional, tapi bagus untuk robustness)
 		_ = c.MakeDir(path)
 		if err := c.ChangeDir(path); err != nil {
-			return fmt.Errorf("failed to change ftp dir: %v", err)
+			return "", fmt.Errorf("failed to change ftp dir: %v", err)
 		}
 	}
 
-	return c.Stor(fileName, file)
+	if err := c.Stor(fileName, file); err != nil {
+		return "", err
+	}
+
+	// FTP tidak punya checksum standar, baca ulang file yang baru diupload
+	remote, err := c.Retr(fileName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read back uploaded file: %v", err)
+	}
+	defer remote.Close()
+	return verifyReadBack(remote, checksum)
 }
 
 // --- SFTP Implementation ---
-func (s *UploaderService) uploadSFTP(cfg map[string]interface{}, file io.Reader, fileName string) error {
+func (s *UploaderService) uploadSFTP(cfg map[string]interface{}, file io.Reader, fileName string, checksum *FileChecksum) (string, error) {
 	host, _ := cfg["host"].(string)
 	port := "22"
 	if p, ok := cfg["port"].(float64); ok {
@@ -163,13 +232,13 @@ func (s *UploaderService) uploadSFTP(cfg map[string]interface{}, file io.Reader,
 
 	sshClient, err := ssh.Dial("tcp", fmt.Sprintf("%s:%s", host, port), sshConfig)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer sshClient.Close()
 
 	sftpClient, err := sftp.NewClient(sshClient)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer sftpClient.Close()
 
@@ -183,10 +252,20 @@ func (s *UploaderService) uploadSFTP(cfg map[string]interface{}, file io.Reader,
 
 	dstFile, err := sftpClient.Create(finalPath)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer dstFile.Close()
 
 	_, err = dstFile.ReadFrom(file)
-	return err
+	dstFile.Close()
+	if err != nil {
+		return "", err
+	}
+
+	// Baca ulang file remote untuk verifikasi
+	remote, err := sftpClient.Open(finalPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read back uploaded file: %v", err)
+	}
+	defer remote.Close()
+	return verifyReadBack(remote, checksum)
 }
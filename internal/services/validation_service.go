@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"databasus-checker/internal/models"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+type ValidationService struct{}
+
+// Batas baris yang dihitung untuk ROWS_GTE agar query besar tidak dibaca semua
+const maxCountedRows = 100000
+
+// Batas baris result set yang disimpan ke Job.QueryResults
+const maxCapturedRows = 50
+
+// RunChecks menjalankan semua assertion ke DB hasil restore. Satu check gagal tidak menghentikan check lain.
+// Result set setiap check ikut dikembalikan (maksimal maxCapturedRows baris).
+func (s *ValidationService) RunChecks(ctx context.Context, db *gorm.DB, checks []models.ValidationCheck) (models.CheckResults, models.QueryResults) {
+	results := make(models.CheckResults, 0, len(checks))
+	captured := make(models.QueryResults, 0, len(checks))
+	for _, check := range checks {
+		result, queryResult := s.runCheck(ctx, db, check)
+		results = append(results, result)
+		if queryResult != nil {
+			captured = append(captured, *queryResult)
+		}
+	}
+	return results, captured
+}
+
+// RunScript menjalankan post-restore script. Jika script berupa satu SELECT, result set-nya ikut dikembalikan;
+// script lain (multi statement, DML) cukup di-Exec seperti biasa.
+func (s *ValidationService) RunScript(ctx context.Context, db *gorm.DB, name, script string) (*models.QueryResult, error) {
+	if !isSingleSelect(script) {
+		return nil, db.WithContext(ctx).Exec(script).Error
+	}
+	return s.queryRows(ctx, db, name, script)
+}
+
+// ScriptOutput output script Postgres: NOTICE / RAISE dari server dan hasil statement terakhir
+type ScriptOutput struct {
+	Notices    []string
+	CommandTag string              // Command tag statement terakhir, mis. "CREATE ROLE" / "INSERT 0 5"
+	LastResult *models.QueryResult // nil jika statement terakhir tidak mengembalikan baris
+}
+
+// RunPostgresScript menjalankan script multi statement lewat koneksi pgconn tersendiri (simple protocol)
+// agar NOTICE / RAISE ikut tertangkap; lewat GORM notice dibuang driver. Output tetap dikembalikan saat error.
+func (s *ValidationService) RunPostgresScript(ctx context.Context, dsn, name, script string) (*ScriptOutput, error) {
+	config, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	output := &ScriptOutput{}
+	config.OnNotice = func(_ *pgconn.PgConn, n *pgconn.Notice) {
+		output.Notices = append(output.Notices, fmt.Sprintf("%s: %s", n.Severity, n.Message))
+	}
+
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	if err != nil {
+		return output, err
+	}
+	defer conn.Close(context.Background())
+
+	results, err := conn.Exec(ctx, script).ReadAll()
+	if err != nil {
+		return output, err
+	}
+	if len(results) == 0 {
+		return output, nil
+	}
+
+	last := results[len(results)-1]
+	output.CommandTag = last.CommandTag.String()
+	if len(last.FieldDescriptions) > 0 {
+		result := &models.QueryResult{Name: name, Rows: [][]string{}, RowCount: len(last.Rows)}
+		for _, field := range last.FieldDescriptions {
+			result.Columns = append(result.Columns, field.Name)
+		}
+		for _, values := range last.Rows {
+			if len(result.Rows) >= maxCapturedRows {
+				break
+			}
+			row := make([]string, len(values))
+			for i, v := range values {
+				if v == nil {
+					row[i] = "NULL"
+				} else {
+					row[i] = string(v)
+				}
+			}
+			result.Rows = append(result.Rows, row)
+		}
+		result.Truncated = result.RowCount > len(result.Rows)
+		output.LastResult = result
+	}
+	return output, nil
+}
+
+func (s *ValidationService) runCheck(ctx context.Context, db *gorm.DB, check models.ValidationCheck) (models.CheckResult, *models.QueryResult) {
+	queryResult, err := s.queryRows(ctx, db, check.Name, check.Query)
+	if err != nil {
+		return models.CheckResult{Name: check.Name, Message: fmt.Sprintf("query error: %v", err)}, nil
+	}
+	return evaluateCheck(check, queryResult), queryResult
+}
+
+// evaluateCheck menilai result set terhadap tipe check. Nilai tunggal = kolom pertama baris pertama.
+// Dipakai bersama oleh check SQL dan MongoDB.
+func evaluateCheck(check models.ValidationCheck, queryResult *models.QueryResult) models.CheckResult {
+	result := models.CheckResult{Name: check.Name}
+
+	rowCount := queryResult.RowCount
+	firstValue, hasValue := "", false
+	if len(queryResult.Rows) > 0 && len(queryResult.Columns) > 0 {
+		firstValue, hasValue = queryResult.Rows[0][0], true
+	}
+
+	switch check.Type {
+	case models.CheckRowsGTE:
+		expected, err := strconv.Atoi(strings.TrimSpace(check.Expected))
+		if err != nil {
+			result.Message = fmt.Sprintf("invalid expected row count %q", check.Expected)
+			return result
+		}
+		result.Actual = fmt.Sprintf("%d rows", rowCount)
+		result.Passed = rowCount >= expected
+		if !result.Passed {
+			result.Message = fmt.Sprintf("expected at least %d rows, got %d", expected, rowCount)
+		}
+
+	case models.CheckScalarEq:
+		if !hasValue {
+			result.Message = "query returned no rows"
+			return result
+		}
+		result.Actual = firstValue
+		result.Passed = scalarEquals(firstValue, check.Expected)
+		if !result.Passed {
+			result.Message = fmt.Sprintf("expected %q, got %q", check.Expected, firstValue)
+		}
+
+	case models.CheckNoRows:
+		result.Actual = fmt.Sprintf("%d rows", rowCount)
+		result.Passed = rowCount == 0
+		if !result.Passed {
+			result.Message = fmt.Sprintf("expected no rows, got %d", rowCount)
+		}
+
+	case models.CheckRegex:
+		re, err := regexp.Compile(check.Expected)
+		if err != nil {
+			result.Message = fmt.Sprintf("invalid regex: %v", err)
+			return result
+		}
+		if !hasValue {
+			result.Message = "query returned no rows"
+			return result
+		}
+		result.Actual = firstValue
+		result.Passed = re.MatchString(firstValue)
+		if !result.Passed {
+			result.Message = fmt.Sprintf("%q does not match /%s/", firstValue, check.Expected)
+		}
+
+	default:
+		result.Message = fmt.Sprintf("unknown check type %q", check.Type)
+	}
+
+	return result
+}
+
+// NewestTimestamp mengambil nilai MAX(column) dari table. Table boleh memakai schema ("public.orders").
+// Return nil jika tabel kosong.
+func (s *ValidationService) NewestTimestamp(ctx context.Context, db *gorm.DB, engine DatabaseEngine, table, column string) (*time.Time, error) {
+	var qualified []string
+	for _, part := range strings.Split(table, ".") {
+		qualified = append(qualified, engine.QuoteIdent(strings.TrimSpace(part)))
+	}
+	query := fmt.Sprintf("SELECT MAX(%s) FROM %s", engine.QuoteIdent(column), strings.Join(qualified, "."))
+
+	var newest sql.NullTime
+	if err := db.WithContext(ctx).Raw(query).Row().Scan(&newest); err != nil {
+		return nil, err
+	}
+	if !newest.Valid {
+		return nil, nil
+	}
+	return &newest.Time, nil
+}
+
+// queryRows menghitung baris hasil query (maksimal maxCountedRows) dan menyimpan maxCapturedRows baris pertama
+func (s *ValidationService) queryRows(ctx context.Context, db *gorm.DB, name, query string) (*models.QueryResult, error) {
+	rows, err := db.WithContext(ctx).Raw(query).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.QueryResult{Name: name, Columns: columns, Rows: [][]string{}}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if result.RowCount < maxCapturedRows && len(columns) > 0 {
+			if err := rows.Scan(pointers...); err != nil {
+				return nil, err
+			}
+			row := make([]string, len(columns))
+			for i, v := range values {
+				row[i] = formatValue(v)
+			}
+			result.Rows = append(result.Rows, row)
+		}
+		result.RowCount++
+		if result.RowCount >= maxCountedRows {
+			break
+		}
+	}
+	result.Truncated = result.RowCount > len(result.Rows)
+	return result, rows.Err()
+}
+
+// isSingleSelect true jika script hanya berisi satu statement SELECT / WITH
+func isSingleSelect(script string) bool {
+	trimmed := strings.TrimRight(strings.TrimSpace(script), "; \t\r\n")
+	if trimmed == "" || strings.Contains(trimmed, ";") {
+		return false
+	}
+	lower := strings.ToLower(trimmed)
+	return strings.HasPrefix(lower, "select") || strings.HasPrefix(lower, "with")
+}
+
+// scalarEquals membandingkan sebagai angka jika keduanya numerik, selain itu sebagai string
+func scalarEquals(actual, expected string) bool {
+	actual = strings.TrimSpace(actual)
+	expected = strings.TrimSpace(expected)
+
+	a, errA := strconv.ParseFloat(actual, 64)
+	e, errE := strconv.ParseFloat(expected, 64)
+	if errA == nil && errE == nil {
+		return a == e
+	}
+	return actual == expected
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"context"
+	"databasus-checker/internal/database"
+	"databasus-checker/internal/models"
+	"databasus-checker/internal/services"
+	"log"
+	"time"
+)
+
+// BackupWatcher memantau Databasus dan otomatis enqueue test saat ada backup baru
+type BackupWatcher struct {
+	QueueService    services.QueueService
+	DatabasusClient services.DatabasusClient
+}
+
+func NewBackupWatcher() *BackupWatcher {
+	return &BackupWatcher{
+		QueueService:    services.QueueService{},
+		DatabasusClient: services.DatabasusClient{},
+	}
+}
+
+func (bw *BackupWatcher) Start() {
+	log.Println("Backup Watcher Started... (Polling Databasus every 60s)")
+
+	go func() {
+		for {
+			bw.checkNewBackups()
+			time.Sleep(60 * time.Second)
+		}
+	}()
+}
+
+func (bw *BackupWatcher) checkNewBackups() {
+	var tests []models.RestoreTestConfig
+	if err := database.DB.Find(&tests).Error; err != nil {
+		log.Printf("Backup Watcher DB Error: %v", err)
+		return
+	}
+
+	for _, test := range tests {
+		backup, err := bw.DatabasusClient.GetLatestBackup(context.Background(), test.DatabasusDatabaseID)
+		if err != nil {
+			// Backup masih berjalan / belum ada, coba lagi di polling berikutnya
+			continue
+		}
+
+		if backup.ID == test.LastProcessedBackupID {
+			continue
+		}
+
+		// Sudah pernah di-enqueue tapi gagal, jangan loop terus. Tunggu backup berikutnya.
+		if backup.ID == test.LastTriggeredBackupID {
+			continue
+		}
+
+		if _, err := bw.QueueService.Enqueue(test.ID.String(), models.TriggerNewBackup); err != nil {
+			log.Printf("Backup Watcher: Skipping test %s: %v", test.Name, err)
+			continue
+		}
+		log.Printf("Backup Watcher: New backup %s detected, queued test %s", backup.ID, test.Name)
+
+		if err := database.DB.Model(&models.RestoreTestConfig{}).
+			Where("id = ?", test.ID).
+			Update("last_triggered_backup_id", backup.ID).Error; err != nil {
+			log.Printf("Backup Watcher: Failed to update last triggered backup for %s: %v", test.Name, err)
+		}
+	}
+}
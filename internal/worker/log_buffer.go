@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interval penyimpanan log job ke DB. Live tail (SSE) membaca DB tiap detik.
+const logFlushInterval = 2 * time.Second
+
+// jobLogBuffer menampung baris log job dan menyimpannya ke DB per interval, bukan per baris:
+// setiap append menulis ulang seluruh kolom log_output.
+type jobLogBuffer struct {
+	mu      sync.Mutex
+	pending strings.Builder
+}
+
+func (b *jobLogBuffer) add(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending.WriteString(line)
+}
+
+// flush menyimpan baris yang tertunda lewat write. Jika write gagal, baris tetap di buffer untuk flush berikutnya.
+func (b *jobLogBuffer) flush(write func(lines string) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending.Len() == 0 {
+		return nil
+	}
+	if err := write(b.pending.String()); err != nil {
+		return err
+	}
+	b.pending.Reset()
+	return nil
+}
+
+// settle menjalankan save yang menyimpan log lengkap (mis. UpdateJob saat job selesai), lalu membuang
+// baris tertunda yang sudah ikut tersimpan. Dijalankan di bawah lock agar tidak ada flush di tengahnya.
+func (b *jobLogBuffer) settle(save func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	save()
+	b.pending.Reset()
+}
@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"context"
+	"databasus-checker/internal/database"
+	"databasus-checker/internal/models"
+	"databasus-checker/internal/services"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	heartbeatTimeout  = 2 * time.Minute
+
+	// Umur container restore selain waktu tunggu DB & restore (validasi, deep check, upload).
+	// Batas per container = StartupTimeout + restore timeout test + margin ini (lihat label expires-at).
+	containerLifetimeMargin = 2 * time.Hour
+
+	// Batas untuk container tanpa label expires-at (dibuat sebelum label ada)
+	defaultContainerLifetime = 24 * time.Hour
+)
+
+// Reaper membereskan job RUNNING yang ditinggal worker (process crash / restart)
+type Reaper struct {
+	QueueService  services.QueueService
+	DockerService services.DockerService
+}
+
+func NewReaper() *Reaper {
+	return &Reaper{
+		QueueService:  services.QueueService{},
+		DockerService: services.DockerService{},
+	}
+}
+
+// Start langsung menjalankan satu kali pembersihan (startup), lalu berkala tiap menit.
+// Dipanggil sebelum worker pool jalan: saat startup belum ada job milik proses ini, jadi semua
+// job RUNNING langsung dianggap ditinggal tanpa menunggu heartbeat timeout.
+func (r *Reaper) Start() {
+	log.Printf("Job Reaper Started... (Heartbeat timeout %s)", heartbeatTimeout)
+	r.reapExpiredJobs(0)
+	r.sweepOrphanContainers()
+
+	go func() {
+		for {
+			time.Sleep(60 * time.Second)
+			r.reapExpiredJobs(heartbeatTimeout)
+			r.sweepOrphanContainers()
+		}
+	}()
+}
+
+// sweepOrphanContainers membersihkan container restore_job_* yang tertinggal (defer StopContainer tidak jalan
+// karena panic / restart, atau container job selesai yang hanya di-stop)
+func (r *Reaper) sweepOrphanContainers() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	removed, err := r.DockerService.SweepOrphanContainers(ctx, defaultContainerLifetime, r.QueueService.GetRunningJobIDs)
+	for _, name := range removed {
+		log.Printf("Reaper: Removed orphan container %s", name)
+	}
+	if err != nil {
+		log.Printf("Reaper: Container sweep failed: %v", err)
+	}
+}
+
+// reapExpiredJobs menandai FAILED job RUNNING yang heartbeat-nya lebih lama dari timeout (0 = semua job RUNNING)
+func (r *Reaper) reapExpiredJobs(timeout time.Duration) {
+	jobs, err := r.QueueService.GetExpiredJobs(timeout)
+	if err != nil {
+		log.Printf("Reaper DB Error: %v", err)
+		return
+	}
+
+	for i := range jobs {
+		job := &jobs[i]
+
+		lastSeen := job.CreatedAt
+		if job.HeartbeatAt != nil {
+			lastSeen = *job.HeartbeatAt
+		} else if job.StartedAt != nil {
+			lastSeen = *job.StartedAt
+		}
+		reason := fmt.Sprintf("Job abandoned: no worker heartbeat since %s (worker crashed or restarted).", lastSeen.Format(time.RFC3339))
+
+		marked, err := r.QueueService.MarkAbandoned(job, reason)
+		if err != nil {
+			log.Printf("Reaper: Failed to mark job %s as failed: %v", job.ID, err)
+			continue
+		}
+		if !marked {
+			continue
+		}
+		log.Printf("Reaper: Job %s (%s) marked as FAILED", job.ID, job.TestSnapshotName)
+
+		if retry, err := r.QueueService.ScheduleRetry(job); err != nil {
+			log.Printf("Reaper: Failed to schedule retry for job %s: %v", job.ID, err)
+		} else if retry != nil {
+			log.Printf("Reaper: Retry for job %s scheduled as job %s (attempt %d)", job.ID, retry.ID, retry.Attempt)
+		} else {
+			// Attempt terakhir: notifikasi seperti job FAILED biasa
+			r.notifyFailed(job, reason)
+		}
+
+		if err := r.DockerService.RemoveContainer("restore_job_" + job.ID.String()); err != nil {
+			log.Printf("Reaper: Failed to remove container for job %s: %v", job.ID, err)
+		}
+	}
+}
+
+func (r *Reaper) notifyFailed(job *models.Job, reason string) {
+	if job.RestoreTestConfigID == nil {
+		return
+	}
+	var config models.RestoreTestConfig
+	if err := database.DB.First(&config, "id = ?", job.RestoreTestConfigID).Error; err != nil {
+		log.Printf("Reaper: Failed to load test config for job %s: %v", job.ID, err)
+		return
+	}
+	if len(config.NotificationIDs) == 0 {
+		return
+	}
+
+	logf := func(format string, a ...interface{}) {
+		log.Printf("Reaper: [Job %s] %s", job.ID.String()[:8], fmt.Sprintf(format, a...))
+	}
+	if err := sendJobNotification(config, "FAILED", reason, logf); err != nil {
+		log.Printf("Reaper: Failed to notify for job %s: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"databasus-checker/internal/database"
+	"databasus-checker/internal/models"
+	"databasus-checker/internal/services"
+	"log"
+	"time"
+)
+
+type Scheduler struct {
+	QueueService    services.QueueService
+	ScheduleService services.ScheduleService
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		QueueService:    services.QueueService{},
+		ScheduleService: services.ScheduleService{},
+	}
+}
+
+func (s *Scheduler) Start() {
+	log.Println("Scheduler Started... (Checking cron schedules every 30s)")
+
+	go func() {
+		for {
+			s.enqueueDueTests()
+			time.Sleep(30 * time.Second)
+		}
+	}()
+}
+
+func (s *Scheduler) enqueueDueTests() {
+	var tests []models.RestoreTestConfig
+	if err := database.DB.Where("cron_expression <> ''").Find(&tests).Error; err != nil {
+		log.Printf("Scheduler DB Error: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, test := range tests {
+		if test.NextRunAt != nil && test.NextRunAt.After(now) {
+			continue
+		}
+
+		// NextRunAt kosong = belum pernah dihitung, cukup hitung jadwalnya tanpa enqueue
+		if test.NextRunAt != nil {
+			if _, err := s.QueueService.Enqueue(test.ID.String(), models.TriggerSchedule); err != nil {
+				log.Printf("Scheduler: Skipping test %s: %v", test.Name, err)
+			} else {
+				log.Printf("Scheduler: Queued test %s (scheduled at %s)", test.Name, test.NextRunAt.Format(time.RFC3339))
+			}
+		}
+
+		next, err := s.ScheduleService.NextRun(test.CronExpression, test.CronTimezone, now)
+		if err != nil {
+			log.Printf("Scheduler: Test %s has %v", test.Name, err)
+			continue
+		}
+		if err := database.DB.Model(&models.RestoreTestConfig{}).
+			Where("id = ?", test.ID).
+			Update("next_run_at", next).Error; err != nil {
+			log.Printf("Scheduler: Failed to update next run for %s: %v", test.Name, err)
+		}
+	}
+}
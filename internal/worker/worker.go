@@ -1,148 +1,357 @@
 package worker
 
 import (
+	"context"
+	"database/sql"
 	"databasus-checker/internal/database"
 	"databasus-checker/internal/models"
 	"databasus-checker/internal/services"
 	"databasus-checker/internal/utils"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
-	"gorm.io/driver/postgres"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 type Worker struct {
-	QueueService    services.QueueService
-	DatabasusClient services.DatabasusClient
-	DockerService   services.DockerService
-	UploaderService services.UploaderService
+	QueueService      services.QueueService
+	DatabasusClient   services.DatabasusClient
+	DockerService     services.DockerService
+	UploaderService   services.UploaderService
+	ValidationService services.ValidationService
+	CompareService    services.CompareService
+	SchemaService     services.SchemaService
+	IntegrityService  services.IntegrityService
+	MongoService      services.MongoService
+
+	// Semaphore global untuk membatasi jumlah container ephemeral yang jalan bersamaan
+	containerSlots chan struct{}
+
+	// Cancel function untuk setiap job yang sedang RUNNING di proses ini
+	mu          sync.Mutex
+	runningJobs map[uuid.UUID]context.CancelFunc
 }
 
 func NewWorker() *Worker {
 	return &Worker{
-		QueueService:    services.QueueService{},
-		DatabasusClient: services.DatabasusClient{},
-		DockerService:   services.DockerService{},
-		UploaderService: services.UploaderService{},
+		QueueService:      services.QueueService{},
+		DatabasusClient:   services.DatabasusClient{},
+		DockerService:     services.DockerService{},
+		UploaderService:   services.UploaderService{},
+		ValidationService: services.ValidationService{},
+		CompareService:    services.CompareService{},
+		SchemaService:     services.SchemaService{},
+		IntegrityService:  services.IntegrityService{},
+		MongoService:      services.MongoService{},
+		runningJobs:       make(map[uuid.UUID]context.CancelFunc),
 	}
 }
 
 func (w *Worker) Start() {
-	log.Println("Background Worker Started... (Polling every 5s)")
+	settings := models.GetSettings(database.DB)
 
-	go func() {
-		for {
-			job, err := w.QueueService.GetPendingJob()
-			if err != nil {
-				log.Printf("Worker DB Error: %v", err)
-				time.Sleep(5 * time.Second)
-				continue
-			}
+	concurrency := settings.WorkerConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	maxContainers := settings.MaxContainers
+	if maxContainers < 1 {
+		maxContainers = concurrency
+	}
+	w.containerSlots = make(chan struct{}, maxContainers)
 
-			if job == nil {
-				time.Sleep(5 * time.Second)
-				continue
-			}
+	log.Printf("Background Worker Started... (%d workers, max %d containers, polling every 5s)", concurrency, maxContainers)
+
+	// Siapkan restore network sekali di awal agar salah konfigurasi langsung terlihat di log
+	if name, err := w.DockerService.EnsureRestoreNetwork(context.Background()); err != nil {
+		log.Printf("WARNING: Restore network not ready, jobs will fail until fixed: %v", err)
+	} else {
+		log.Printf("Restore network %s ready", name)
+	}
+
+	for i := 1; i <= concurrency; i++ {
+		go w.run(i)
+	}
+}
 
-			log.Printf("Worker: Processing Job ID %s (Test: %s)", job.ID, job.RestoreTestConfig.Name)
-			w.processJob(job)
+func (w *Worker) run(workerID int) {
+	for {
+		job, err := w.QueueService.GetPendingJob()
+		if err != nil {
+			log.Printf("Worker #%d DB Error: %v", workerID, err)
+			time.Sleep(5 * time.Second)
+			continue
 		}
-	}()
+
+		if job == nil {
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		log.Printf("Worker #%d: Processing Job ID %s (Test: %s)", workerID, job.ID, job.RestoreTestConfig.Name)
+		w.processJob(job)
+	}
+}
+
+// CancelJob membatalkan job yang sedang dikerjakan worker ini.
+// Return false jika job tidak sedang berjalan di proses ini.
+func (w *Worker) CancelJob(jobID uuid.UUID) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cancel, ok := w.runningJobs[jobID]
+	if ok {
+		cancel()
+	}
+	return ok
 }
 
 func (w *Worker) processJob(job *models.Job) {
 	var logs strings.Builder
 
+	ctx, cancel := context.WithCancel(context.Background())
+	w.mu.Lock()
+	w.runningJobs[job.ID] = cancel
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.runningJobs, job.ID)
+		w.mu.Unlock()
+		cancel()
+	}()
+
+	// Log disimpan ke DB per logFlushInterval agar bisa di-tail selama job berjalan
+	var logBuffer jobLogBuffer
+	flushLogs := func() {
+		err := logBuffer.flush(func(lines string) error {
+			return w.QueueService.AppendLog(job.ID, lines)
+		})
+		if err != nil {
+			log.Printf("[Job %s] WARN: Failed to persist log lines: %v", job.ID.String()[:8], err)
+		}
+	}
+	// Sisa log (mis. notifikasi setelah job selesai) disimpan sebelum ctx di-cancel
+	defer flushLogs()
+
+	// Heartbeat agar Reaper tahu job ini masih hidup
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		flushTicker := time.NewTicker(logFlushInterval)
+		defer flushTicker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := w.QueueService.Heartbeat(job.ID); err != nil {
+					log.Printf("[Job %s] WARN: Failed to send heartbeat: %v", job.ID.String()[:8], err)
+				}
+				// Job bisa dibatalkan dari instance lain (status CANCELLED di DB)
+				if status, err := w.QueueService.GetJobStatus(job.ID); err == nil && status == "CANCELLED" {
+					log.Printf("[Job %s] Cancelled from another instance, stopping.", job.ID.String()[:8])
+					cancel()
+					return
+				}
+			case <-flushTicker.C:
+				flushLogs()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
 	logPrint := func(format string, a ...interface{}) {
 		msg := fmt.Sprintf(format, a...)
 		timestamp := time.Now().Format("15:04:05")
-		logs.WriteString(fmt.Sprintf("[%s] %s\n", timestamp, msg))
+		line := fmt.Sprintf("[%s] %s\n", timestamp, msg)
+		logs.WriteString(line)
 		log.Printf("[Job %s] %s", job.ID.String()[:8], msg)
+		logBuffer.add(line)
 	}
 
-	sendNotification := func(isSuccess bool, message string) {
-		var notifs []models.NotificationConfig
-		notificationIDs := []string(job.RestoreTestConfig.NotificationIDs)
+	sendNotification := func(status string, message string) error {
+		return sendJobNotification(job.RestoreTestConfig, status, message, logPrint)
+	}
 
-		if len(notificationIDs) > 0 {
-			if err := database.DB.Where("id IN ?", notificationIDs).Find(&notifs).Error; err != nil {
-				logPrint("ERROR: Failed to fetch notification configs: %v", err)
-				return
-			}
-			
-			status := "FAILED"
-			if isSuccess {
-				status = "SUCCESS"
+	// Timeline: setiap fase dicatat sebagai JobStep. Step yang masih terbuka saat job selesai ikut ditutup.
+	var currentStep *models.JobStep
+	stepPosition := 0
+
+	endStep := func(stepErr error) {
+		if currentStep == nil {
+			return
+		}
+		status, errMsg := "SUCCESS", ""
+		if stepErr != nil {
+			status, errMsg = "FAILED", stepErr.Error()
+			if ctx.Err() != nil {
+				status = "CANCELLED"
 			}
-			
-			fullMsg := fmt.Sprintf("[%s] Restore Test: %s\n\n%s", status, job.RestoreTestConfig.Name, message)
+		}
+		w.QueueService.FinishStep(currentStep, status, errMsg)
+		currentStep = nil
+	}
 
-			for _, n := range notifs {
-				logPrint("Sending notification to %s (%s)...", n.Name, n.Type)
-				cfg := n.Config
-				
-				if n.Type == "TELEGRAM" {
-					token, _ := cfg["bot_token"].(string)
-					chatID, _ := cfg["chat_id"].(string)
-					utils.SendTelegram(token, chatID, fullMsg)
-				} else if n.Type == "EMAIL" {
-					host, _ := cfg["host"].(string)
-					portStr := fmt.Sprintf("%v", cfg["port"])
-					port := 587
-					fmt.Sscanf(portStr, "%d", &port)
-					
-					utils.SendEmail(
-						host, port,
-						cfg["user"].(string), cfg["password"].(string),
-						cfg["from_email"].(string), cfg["to_email"].(string),
-						fmt.Sprintf("Databasus Checker: %s", status),
-						fullMsg,
-					)
-				}
+	beginStep := func(name string) {
+		endStep(nil)
+		stepPosition++
+		step, err := w.QueueService.StartStep(job.ID, name, stepPosition)
+		if err != nil {
+			log.Printf("[Job %s] WARN: Failed to record step %s: %v", job.ID.String()[:8], name, err)
+		}
+		currentStep = step
+	}
+
+	skipStep := func(name string) {
+		endStep(nil)
+		stepPosition++
+		w.QueueService.SkipStep(job.ID, name, stepPosition)
+	}
+
+	// Kegagalan deterministik (backup rusak / basi, assertion, dll) tidak di-retry, lihat failNoRetry
+	retryable := true
+
+	// Simpan hasil akhir job. Job yang dibatalkan user dicatat CANCELLED tanpa notifikasi.
+	// Job FAILED yang masih punya sisa attempt dijadwalkan ulang, notifikasi hanya di attempt terakhir.
+	finishJob := func(status string, message string) {
+		if status == "FAILED" && ctx.Err() != nil {
+			status = "CANCELLED"
+			logPrint("Job cancelled by user.")
+		}
+
+		if status == "SUCCESS" || status == "WARNING" {
+			endStep(nil)
+		} else {
+			endStep(errors.New(message))
+		}
+
+		notify := status != "CANCELLED"
+		if status == "FAILED" && !retryable {
+			if job.RestoreTestConfig.MaxAttempts > 1 {
+				logPrint("Failure is not retryable, no retry scheduled.")
+			}
+		} else if status == "FAILED" {
+			retry, err := w.QueueService.ScheduleRetry(job)
+			if err != nil {
+				logPrint("WARN: Failed to schedule retry: %v", err)
+			} else if retry != nil {
+				logPrint("Attempt %d/%d failed. Retry scheduled at %s (Job %s).",
+					job.Attempt, job.RestoreTestConfig.MaxAttempts, retry.RunAfter.Format("15:04:05"), retry.ID.String()[:8])
+				notify = false
 			}
 		}
+
+		job.MarkFinished(status, logs.String())
+		logBuffer.settle(func() { w.QueueService.UpdateJob(job) }) // Log lengkap ikut tersimpan
+		if notify && len(job.RestoreTestConfig.NotificationIDs) > 0 {
+			beginStep(models.StepNotify)
+			endStep(sendNotification(status, message))
+		}
+	}
+
+	// failNoRetry untuk kegagalan yang hasilnya sama jika diulang: langsung notifikasi, tanpa retry.
+	// Retry hanya untuk gangguan infrastruktur (Databasus API, Docker, readiness, storage).
+	failNoRetry := func(message string) {
+		retryable = false
+		finishJob("FAILED", message)
 	}
 
 	logPrint("Starting job execution...")
 
 	// 1. Get Latest Backup
+	beginStep(models.StepFetchBackup)
 	logPrint("Fetching latest backup for DB ID: %s", job.RestoreTestConfig.DatabasusDatabaseID)
-	backup, err := w.DatabasusClient.GetLatestBackup(job.RestoreTestConfig.DatabasusDatabaseID)
+	backup, err := w.DatabasusClient.GetLatestBackup(ctx, job.RestoreTestConfig.DatabasusDatabaseID)
 	if err != nil {
 		logPrint("ERROR: Failed to get backup: %v", err)
-		job.MarkFinished("FAILED", logs.String())
-		w.QueueService.UpdateJob(job)
-		sendNotification(false, fmt.Sprintf("Failed to fetch backup: %v", err))
+		finishJob("FAILED", fmt.Sprintf("Failed to fetch backup: %v", err))
 		return
 	}
 	logPrint("Found backup ID: %s (Status: %s)", backup.ID, backup.Status)
 
-	// 2. Fetch DB Version
+	// 1b. Umur backup. Backup yang terlalu tua langsung gagal sebelum container dibuat
+	backupCreatedAt := backup.CreatedAtIn(models.GetSettings(database.DB).DatabasusTimezone)
+	backupAge := time.Since(backupCreatedAt)
+	logPrint("Backup created at %s (age %s)", backupCreatedAt.Format(time.RFC3339), backupAge.Round(time.Second))
+	if job.RestoreTestConfig.MaxBackupAgeHours > 0 {
+		maxBackupAge := time.Duration(job.RestoreTestConfig.MaxBackupAgeHours) * time.Hour
+		if backupAge > maxBackupAge {
+			logPrint("ERROR: Backup too old (%s > %s)", backupAge.Round(time.Second), maxBackupAge)
+			failNoRetry(fmt.Sprintf("Backup too old: latest backup %s was created %s ago (max %s)",
+				backup.ID, backupAge.Round(time.Minute), maxBackupAge))
+			return
+		}
+	}
+
+	// 2. Fetch DB Engine & Version
+	beginStep(models.StepResolveVersion)
 	logPrint("Fetching Database Version info...")
-	pgVersion, err := w.DatabasusClient.GetDatabaseVersion(job.RestoreTestConfig.WorkspaceID, job.RestoreTestConfig.DatabasusDatabaseID)
+	engine, dbVersion, err := w.DatabasusClient.GetDatabaseEngine(ctx, job.RestoreTestConfig.WorkspaceID, job.RestoreTestConfig.DatabasusDatabaseID)
+	if err != nil && ctx.Err() != nil {
+		finishJob("FAILED", "Job cancelled.")
+		return
+	}
+	if errors.Is(err, services.ErrUnsupportedEngine) {
+		logPrint("ERROR: %v", err)
+		failNoRetry(fmt.Sprintf("Cannot test this database: %v", err))
+		return
+	}
 	if err != nil {
-		logPrint("WARN: Failed to get version, defaulting to 15. Error: %v", err)
-		pgVersion = "15"
+		logPrint("WARN: Failed to get version, defaulting to %s %s. Error: %v", engine.Name, dbVersion, err)
+	}
+	logPrint("Target Engine: %s, Version: %s", engine.Name, dbVersion)
+
+	// 3. Spawn Docker (tunggu slot container kosong)
+	beginStep(models.StepSpawnContainer)
+	select {
+	case w.containerSlots <- struct{}{}:
+	default:
+		logPrint("Container limit reached, waiting for a free slot...")
+		select {
+		case w.containerSlots <- struct{}{}:
+		case <-ctx.Done():
+			finishJob("FAILED", "Job cancelled.")
+			return
+		}
 	}
-	logPrint("Target PostgreSQL Version: %s", pgVersion)
+	defer func() { <-w.containerSlots }()
+
+	restoreTimeout := time.Duration(job.RestoreTestConfig.RestoreTimeoutMinutes) * time.Minute
+	if restoreTimeout <= 0 {
+		restoreTimeout = 60 * time.Minute
+	}
+
+	containerOpts := services.ContainerOptions{
+		Image: job.RestoreTestConfig.ContainerImage,
+		Env:   job.RestoreTestConfig.ContainerEnv,
+		Args:  job.RestoreTestConfig.ContainerArgs,
+
+		CPULimit:      job.RestoreTestConfig.CPULimit,
+		MemoryLimitMB: job.RestoreTestConfig.MemoryLimitMB,
+		PidsLimit:     job.RestoreTestConfig.PidsLimit,
 
-	// 3. Spawn Docker
-	logPrint("Spawning temporary Postgres container (Tag: postgres:%s-alpine)...", pgVersion)
-	ephemeralDB, err := w.DockerService.SpawnPostgres(job.ID.String(), pgVersion)
+		// Sweeper tidak boleh menghapus container sebelum restore timeout habis
+		MaxLifetime: engine.StartupTimeout + restoreTimeout + containerLifetimeMargin,
+	}
+	logPrint("Spawning temporary %s container (Image: %s)...", engine.Name, containerOpts.ImageFor(engine, dbVersion))
+	if len(containerOpts.Args) > 0 {
+		logPrint("Container args: %s", strings.Join(containerOpts.Args, " "))
+	}
+	ephemeralDB, err := w.DockerService.SpawnDatabase(ctx, job.ID.String(), engine, dbVersion, containerOpts)
 	if err != nil {
 		logPrint("ERROR: Failed to spawn docker: %v", err)
-		job.MarkFinished("FAILED", logs.String())
-		w.QueueService.UpdateJob(job)
-		sendNotification(false, fmt.Sprintf("Failed to spawn docker: %v", err))
+		finishJob("FAILED", fmt.Sprintf("Failed to spawn docker: %v", err))
 		return
 	}
-	logPrint("Container Created. Port: %d, DB: %s, User: %s", ephemeralDB.Port, ephemeralDB.DBName, ephemeralDB.User)
+	logPrint("Container Created. Host: %s:%d, DB: %s, User: %s", ephemeralDB.Host, ephemeralDB.Port, ephemeralDB.DBName, ephemeralDB.User)
 
 	defer func() {
 		logPrint("Cleaning up: Stopping container %s...", ephemeralDB.ContainerID)
@@ -151,67 +360,351 @@ func (w *Worker) processJob(job *models.Job) {
 		}
 	}()
 
-	// 4. Wait for Postgres
-	logPrint("Waiting for Postgres to be ready...")
-	dbDSN := fmt.Sprintf("host=host.docker.internal user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=UTC", 
-		ephemeralDB.User, ephemeralDB.Password, ephemeralDB.DBName, ephemeralDB.Port)
-	
+	// 4. Wait for Database
+	beginStep(models.StepWaitReady)
+	logPrint("Waiting for %s to be ready (timeout %s)...", engine.Name, engine.StartupTimeout)
+	dialector := engine.Dialector(ephemeralDB.Host, ephemeralDB.Port, ephemeralDB.User, ephemeralDB.Password, ephemeralDB.DBName)
+
+	// MongoDB tidak lewat GORM: targetDB nil, semua query memakai targetMongo.
+	// Pool GORM dibuka sekali (tanpa auto ping), yang diulang hanya ping-nya.
 	var targetDB *gorm.DB
-	for i := 0; i < 15; i++ { 
-		time.Sleep(2 * time.Second)
-		targetDB, err = gorm.Open(postgres.Open(dbDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	var targetMongo *mongo.Database
+	if !engine.IsMongo() {
+		targetDB, err = gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent), DisableAutomaticPing: true})
 		if err == nil {
-			sqlDB, dbErr := targetDB.DB()
-			if dbErr == nil {
-				if pingErr := sqlDB.Ping(); pingErr == nil {
-					logPrint("Connected to temporary database.")
-					break
-				}
+			var sqlDB *sql.DB
+			if sqlDB, err = targetDB.DB(); err == nil {
+				defer sqlDB.Close()
 			}
 		}
-		if i == 14 {
+		if err != nil {
+			logPrint("ERROR: Failed to open temp database: %v", err)
+			finishJob("FAILED", fmt.Sprintf("Failed to open temporary database: %v", err))
+			return
+		}
+	}
+	readyAttempts := int(engine.StartupTimeout / (2 * time.Second))
+	for i := 0; i < readyAttempts; i++ {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-ctx.Done():
+			finishJob("FAILED", "Job cancelled.")
+			return
+		}
+		if engine.IsMongo() {
+			client, err := w.MongoService.Connect(ctx, ephemeralDB)
+			if err == nil {
+				targetMongo = client.Database(ephemeralDB.DBName)
+				logPrint("Connected to temporary database.")
+				break
+			}
+		} else {
+			sqlDB, _ := targetDB.DB()
+			pingCtx, cancelPing := context.WithTimeout(ctx, 5*time.Second)
+			pingErr := sqlDB.PingContext(pingCtx)
+			cancelPing()
+			if pingErr == nil {
+				logPrint("Connected to temporary database.")
+				break
+			}
+		}
+		if i == readyAttempts-1 {
 			logPrint("ERROR: Timed out waiting for temp database.")
-			job.MarkFinished("FAILED", logs.String())
-			w.QueueService.UpdateJob(job)
-			sendNotification(false, "Timeout waiting for temporary database.")
+			finishJob("FAILED", "Timeout waiting for temporary database.")
+			return
+		}
+	}
+	if targetMongo != nil {
+		defer targetMongo.Client().Disconnect(context.Background())
+	}
+
+	// 4b. Pre-Restore Script (role, extension, tablespace yang dibutuhkan dump). MongoDB: satu command JSON
+	if job.RestoreTestConfig.PreRestoreScript == "" {
+		skipStep(models.StepPreRestore)
+	} else {
+		beginStep(models.StepPreRestore)
+		logPrint("Running Pre-Restore Script...")
+		// Output script (NOTICE / RAISE, hasil statement terakhir, response command MongoDB) ikut dicatat ke log
+		var scriptResult *models.QueryResult
+		summary := ""
+		switch {
+		case engine.IsMongo():
+			scriptResult, err = w.MongoService.RunCommand(ctx, targetMongo, "Pre-Restore Script", job.RestoreTestConfig.PreRestoreScript)
+		case engine.IsPostgres():
+			dsn := services.PostgresDSN(ephemeralDB.Host, ephemeralDB.Port, ephemeralDB.User, ephemeralDB.Password, ephemeralDB.DBName)
+			var output *services.ScriptOutput
+			output, err = w.ValidationService.RunPostgresScript(ctx, dsn, "Pre-Restore Script", job.RestoreTestConfig.PreRestoreScript)
+			if output != nil {
+				for _, notice := range output.Notices {
+					logPrint("  %s", notice)
+				}
+				scriptResult, summary = output.LastResult, output.CommandTag
+			}
+		default:
+			result := targetDB.WithContext(ctx).Exec(job.RestoreTestConfig.PreRestoreScript)
+			err = result.Error
+			summary = fmt.Sprintf("%d rows affected", result.RowsAffected)
+		}
+		if err != nil {
+			logPrint("PRE-RESTORE SCRIPT FAILED: %v", err)
+			failNoRetry(fmt.Sprintf("Pre-Restore Script Failed: %v", err))
 			return
 		}
+		if scriptResult != nil {
+			logPrint("Pre-Restore Script returned %d rows:", scriptResult.RowCount)
+			for _, line := range formatQueryResult(scriptResult) {
+				logPrint("  %s", line)
+			}
+		} else if summary != "" {
+			logPrint("Pre-Restore Script executed (%s).", summary)
+		} else {
+			logPrint("Pre-Restore Script executed.")
+		}
 	}
 
 	// 5. Trigger Restore
+	beginStep(models.StepRestore)
 	logPrint("Triggering Restore API...")
-	err = w.DatabasusClient.TriggerRestore(backup.ID, "host.docker.internal", ephemeralDB.Port, ephemeralDB.User, ephemeralDB.Password, ephemeralDB.DBName)
+	restoreStartedAt := time.Now()
+	restoreID, err := w.DatabasusClient.TriggerRestore(ctx, backup.ID, engine, ephemeralDB.Host, ephemeralDB.Port, ephemeralDB.User, ephemeralDB.Password, ephemeralDB.DBName)
 	if err != nil {
 		logPrint("ERROR: Restore API call failed: %v", err)
-		job.MarkFinished("FAILED", logs.String())
-		w.QueueService.UpdateJob(job)
-		sendNotification(false, fmt.Sprintf("Restore API Failed: %v", err))
+		finishJob("FAILED", fmt.Sprintf("Restore API Failed: %v", err))
 		return
 	}
+	if restoreID != "" {
+		logPrint("Restore started (ID: %s).", restoreID)
+	}
 
-	// 6. Wait Data
-	logPrint("Waiting for restore data (30 seconds)...")
-	time.Sleep(30 * time.Second)
+	// 6. Wait Restore Completion
+	logPrint("Waiting for Databasus restore to complete (timeout %s)...", restoreTimeout)
+	_, err = w.DatabasusClient.WaitForRestore(ctx, backup.ID, restoreID, restoreStartedAt, restoreTimeout, func(status string) {
+		logPrint("Restore status: %s", status)
+	})
+	if err != nil {
+		logPrint("ERROR: %v", err)
+		finishJob("FAILED", fmt.Sprintf("Restore Failed: %v", err))
+		return
+	}
+	job.RestoreDurationSeconds = int(time.Since(restoreStartedAt).Seconds())
+	logPrint("Restore completed in %s.", time.Duration(job.RestoreDurationSeconds)*time.Second)
 
-	// 7. Validation
-	if job.RestoreTestConfig.PostRestoreScript != "" {
-		logPrint("Running Post-Restore Validation...")
-		if err := targetDB.Exec(job.RestoreTestConfig.PostRestoreScript).Error; err != nil {
-			logPrint("VALIDATION FAILED: %v", err)
-			job.MarkFinished("FAILED", logs.String())
-			w.QueueService.UpdateJob(job)
-			sendNotification(false, fmt.Sprintf("Validation SQL Failed: %v", err))
-			return
+	// Check yang dikonfigurasi tapi tidak didukung engine ini: job tidak boleh berakhir SUCCESS (lihat 8c)
+	var unsupportedChecks []string
+
+	// 6b. Schema Fingerprint & drift dibanding run sebelumnya. Gagal di sini hanya dicatat, job tetap lanjut.
+	// Query katalog hanya tersedia untuk PostgreSQL.
+	if !engine.IsPostgres() {
+		if job.RestoreTestConfig.NotifyOnSchemaChange {
+			logPrint("WARNING: Schema fingerprint & change notification are only supported for PostgreSQL, not run.")
+			unsupportedChecks = append(unsupportedChecks, "schema change notification")
+		} else {
+			logPrint("Schema fingerprint is only supported for PostgreSQL, not captured.")
+		}
+		skipStep(models.StepSchema)
+	} else {
+		beginStep(models.StepSchema)
+		if snapshot, err := w.SchemaService.Snapshot(ctx, targetDB); err != nil {
+			logPrint("WARN: Failed to capture schema snapshot: %v", err)
+			endStep(err)
+		} else {
+			job.SchemaSnapshot = snapshot
+			job.SchemaFingerprint = w.SchemaService.Fingerprint(snapshot)
+			logPrint("Schema fingerprint: %s (%d objects)", job.SchemaFingerprint[:12], len(snapshot))
+
+			previous, err := w.QueueService.GetPreviousSchemaJob(job.RestoreTestConfig.ID, job.ID)
+			if err != nil {
+				logPrint("WARN: Failed to load previous schema fingerprint: %v", err)
+			} else if previous == nil {
+				logPrint("No previous schema fingerprint, this run becomes the baseline.")
+			} else if previous.SchemaFingerprint == job.SchemaFingerprint {
+				logPrint("Schema unchanged since job %s.", previous.ID.String()[:8])
+			} else {
+				job.SchemaDiff = w.SchemaService.Diff(previous, snapshot)
+				logPrint("SCHEMA CHANGED since job %s: %d added, %d removed.",
+					previous.ID.String()[:8], len(job.SchemaDiff.Added), len(job.SchemaDiff.Removed))
+				for _, line := range job.SchemaDiff.Added {
+					logPrint("  + %s", line)
+				}
+				for _, line := range job.SchemaDiff.Removed {
+					logPrint("  - %s", line)
+				}
+
+				if job.RestoreTestConfig.NotifyOnSchemaChange {
+					msg := fmt.Sprintf("Schema changed since job %s: %d added, %d removed.\nBackup: %s",
+						previous.ID.String()[:8], len(job.SchemaDiff.Added), len(job.SchemaDiff.Removed), backup.ID)
+					if err := sendNotification("SCHEMA CHANGED", msg); err != nil {
+						logPrint("WARN: Schema change notification failed: %v", err)
+					}
+				}
+			}
+		}
+	}
+
+	// 7. Validation (Post-Restore Script + Assertion Checks)
+	checks := []models.ValidationCheck(job.RestoreTestConfig.Checks)
+	if job.RestoreTestConfig.PostRestoreScript == "" && len(checks) == 0 {
+		skipStep(models.StepValidate)
+	} else {
+		beginStep(models.StepValidate)
+		if job.RestoreTestConfig.PostRestoreScript != "" {
+			logPrint("Running Post-Restore Validation...")
+			var scriptResult *models.QueryResult
+			if engine.IsMongo() {
+				scriptResult, err = w.MongoService.RunCommand(ctx, targetMongo, "Post-Restore Script", job.RestoreTestConfig.PostRestoreScript)
+			} else {
+				scriptResult, err = w.ValidationService.RunScript(ctx, targetDB, "Post-Restore Script", job.RestoreTestConfig.PostRestoreScript)
+			}
+			if err != nil {
+				logPrint("VALIDATION FAILED: %v", err)
+				failNoRetry(fmt.Sprintf("Validation SQL Failed: %v", err))
+				return
+			}
+			if scriptResult != nil {
+				logPrint("Post-Restore Script returned %d rows.", scriptResult.RowCount)
+				job.QueryResults = append(job.QueryResults, *scriptResult)
+			}
+		}
+
+		if len(checks) > 0 {
+			logPrint("Running %d validation checks...", len(checks))
+			var checkRows models.QueryResults
+			if engine.IsMongo() {
+				job.CheckResults, checkRows = w.MongoService.RunChecks(ctx, targetMongo, checks)
+			} else {
+				job.CheckResults, checkRows = w.ValidationService.RunChecks(ctx, targetDB, checks)
+			}
+			job.QueryResults = append(job.QueryResults, checkRows...)
+
+			var failedChecks []string
+			for _, result := range job.CheckResults {
+				if result.Passed {
+					logPrint("CHECK PASSED: %s (%s)", result.Name, result.Actual)
+				} else {
+					logPrint("CHECK FAILED: %s - %s", result.Name, result.Message)
+					failedChecks = append(failedChecks, result.Name)
+				}
+			}
+			if len(failedChecks) > 0 {
+				failNoRetry(fmt.Sprintf("Validation Failed: %d/%d checks failed (%s)",
+					len(failedChecks), len(checks), strings.Join(failedChecks, ", ")))
+				return
+			}
 		}
 		logPrint("Validation Passed.")
 	}
 
+	// 7b. Freshness (RPO): data terbaru di DB hasil restore harus dekat dengan waktu backup
+	freshnessTable, freshnessColumn := job.RestoreTestConfig.FreshnessTable, job.RestoreTestConfig.FreshnessColumn
+	if freshnessTable == "" || freshnessColumn == "" || job.RestoreTestConfig.FreshnessMaxAgeMinutes <= 0 {
+		skipStep(models.StepFreshness)
+	} else {
+		beginStep(models.StepFreshness)
+		maxAge := time.Duration(job.RestoreTestConfig.FreshnessMaxAgeMinutes) * time.Minute
+		logPrint("Checking data freshness on %s.%s (max age %s)...", freshnessTable, freshnessColumn, maxAge)
+		var newest *time.Time
+		if engine.IsMongo() {
+			newest, err = w.MongoService.NewestTimestamp(ctx, targetMongo, freshnessTable, freshnessColumn)
+		} else {
+			newest, err = w.ValidationService.NewestTimestamp(ctx, targetDB, engine, freshnessTable, freshnessColumn)
+		}
+		if err != nil {
+			logPrint("FRESHNESS CHECK FAILED: %v", err)
+			failNoRetry(fmt.Sprintf("Freshness Check Failed: %v", err))
+			return
+		}
+		if newest == nil {
+			logPrint("FRESHNESS CHECK FAILED: %s is empty", freshnessTable)
+			failNoRetry(fmt.Sprintf("Freshness Check Failed: %s has no rows", freshnessTable))
+			return
+		}
+
+		age := backupCreatedAt.Sub(*newest)
+		logPrint("Newest row: %s, backup created: %s (age %s)", newest.Format(time.RFC3339), backupCreatedAt.Format(time.RFC3339), age.Round(time.Second))
+		if age > maxAge {
+			failNoRetry(fmt.Sprintf("Freshness Check Failed: newest row in %s is %s older than the backup (max %s)",
+				freshnessTable, age.Round(time.Second), maxAge))
+			return
+		}
+		logPrint("Freshness Check Passed.")
+	}
+
+	// 7c. Compare dengan DB sumber (row count per tabel & objek schema)
+	if job.RestoreTestConfig.SourceDSN == "" {
+		skipStep(models.StepCompareSource)
+	} else if !engine.IsPostgres() {
+		logPrint("WARNING: Source comparison is only supported for PostgreSQL, not run.")
+		unsupportedChecks = append(unsupportedChecks, "source comparison")
+		skipStep(models.StepCompareSource)
+	} else {
+		beginStep(models.StepCompareSource)
+		logPrint("Comparing restored database against source (tolerance %.2f%%)...", job.RestoreTestConfig.CompareTolerancePercent)
+		sourceDB, err := w.CompareService.OpenSource(ctx, job.RestoreTestConfig.SourceDSN)
+		if err != nil {
+			logPrint("ERROR: %v", err)
+			finishJob("FAILED", fmt.Sprintf("Source Comparison Failed: %v", err))
+			return
+		}
+		report, err := w.CompareService.Compare(ctx, sourceDB, targetDB, job.RestoreTestConfig.CompareTolerancePercent)
+		if sqlDB, dbErr := sourceDB.DB(); dbErr == nil {
+			sqlDB.Close()
+		}
+		if err != nil {
+			logPrint("ERROR: %v", err)
+			finishJob("FAILED", fmt.Sprintf("Source Comparison Failed: %v", err))
+			return
+		}
+
+		logPrint("Compared %d tables.", len(report.Tables))
+		for _, obj := range report.ExtraObjects {
+			logPrint("Only in restore (ignored): %s", obj)
+		}
+		for _, violation := range report.Violations {
+			logPrint("COMPARE MISMATCH: %s", violation)
+		}
+		if len(report.Violations) > 0 {
+			failNoRetry(fmt.Sprintf("Source Comparison Failed: %d differences above tolerance", len(report.Violations)))
+			return
+		}
+		logPrint("Source Comparison Passed.")
+	}
+
+	// 7d. Deep Check (korupsi fisik heap & index)
+	if !job.RestoreTestConfig.DeepCheck {
+		skipStep(models.StepDeepCheck)
+	} else if !engine.IsPostgres() {
+		logPrint("WARNING: Deep check is only supported for PostgreSQL, not run.")
+		unsupportedChecks = append(unsupportedChecks, "deep check")
+		skipStep(models.StepDeepCheck)
+	} else {
+		beginStep(models.StepDeepCheck)
+		logPrint("Running deep integrity check...")
+		findings, tool, err := w.IntegrityService.DeepCheck(ctx, targetDB, ephemeralDB)
+		if err != nil {
+			logPrint("ERROR: Deep check (%s) failed to run: %v", tool, err)
+			finishJob("FAILED", fmt.Sprintf("Deep Check Failed: %v", err))
+			return
+		}
+		if len(findings) > 0 {
+			job.IntegrityFindings = findings
+			for _, finding := range findings {
+				logPrint("CORRUPTION: %s", finding)
+			}
+			failNoRetry(fmt.Sprintf("Deep Check Failed: %s reported %d findings", tool, len(findings)))
+			return
+		}
+		logPrint("Deep Check Passed (%s).", tool)
+	}
+
 	// 8. Upload to Storage
 	storageIDs := []string(job.RestoreTestConfig.StorageIDs)
 	finalStatus := "SUCCESS"
 	finalMessage := fmt.Sprintf("Backup %s validated successfully.", backup.ID)
 
-	if len(storageIDs) > 0 {
+	if len(storageIDs) == 0 {
+		skipStep(models.StepUpload)
+	} else {
+		beginStep(models.StepUpload)
 		logPrint("Starting Upload Process...")
 		
 		searchPattern := filepath.Join(os.Getenv("BACKUP_PATH"), backup.ID + "*")
@@ -227,6 +720,15 @@ func (w *Worker) processJob(job *models.Job) {
 			localFilePath := matches[0]
 			logPrint("Found local backup file: %s", localFilePath)
 
+			checksum, err := w.UploaderService.ComputeChecksum(localFilePath)
+			if err != nil {
+				logPrint("ERROR: Failed to checksum backup file: %v", err)
+				finishJob("FAILED", fmt.Sprintf("Restore success but Upload failed: %v", err))
+				return
+			}
+			job.BackupSHA256 = checksum.SHA256
+			logPrint("SHA-256: %s", checksum.SHA256)
+
 			timestamp := backup.CreatedAt.Format("20060102_150405")
 			remoteFileName := fmt.Sprintf("%s-%s-backup.dump", job.RestoreTestConfig.DatabasusDatabaseName, timestamp)
 			
@@ -238,27 +740,54 @@ func (w *Worker) processJob(job *models.Job) {
 				finalStatus = "FAILED"
 			} else {
 				for _, storage := range storages {
+					if ctx.Err() != nil {
+						finishJob("FAILED", "Job cancelled.")
+						return
+					}
 					logPrint("Uploading to %s (%s)...", storage.Name, storage.Type)
-					if err := w.UploaderService.UploadToStorage(storage, localFilePath, remoteFileName); err != nil {
+					verifiedBy, err := w.UploaderService.UploadToStorage(storage, localFilePath, remoteFileName, checksum)
+					if err != nil {
 						logPrint("ERROR: Upload failed: %v", err)
 						finalStatus = "FAILED"
 						finalMessage = fmt.Sprintf("Restore success but Upload to %s failed: %v", storage.Name, err)
 					} else {
-						logPrint("Upload Success.")
+						logPrint("Upload Success (verified by %s).", verifiedBy)
 					}
 				}
 			}
 		}
 	}
 
+	// 8b. RTO: restore sukses tapi lebih lama dari target dicatat WARNING
+	if finalStatus == "SUCCESS" && job.RestoreTestConfig.RTOTargetMinutes > 0 {
+		rtoTarget := time.Duration(job.RestoreTestConfig.RTOTargetMinutes) * time.Minute
+		restoreDuration := time.Duration(job.RestoreDurationSeconds) * time.Second
+		if restoreDuration > rtoTarget {
+			logPrint("WARNING: Restore took %s, exceeding the RTO target of %s.", restoreDuration, rtoTarget)
+			finalStatus = "WARNING"
+			finalMessage = fmt.Sprintf("Backup %s validated, but the restore took %s which exceeds the RTO target of %s.",
+				backup.ID, restoreDuration, rtoTarget)
+		}
+	}
+
+	// 8c. Check yang dikonfigurasi operator tapi tidak jalan dicatat WARNING, bukan dilewati diam-diam
+	if len(unsupportedChecks) > 0 && (finalStatus == "SUCCESS" || finalStatus == "WARNING") {
+		msg := fmt.Sprintf("Configured checks not run (not supported for %s): %s.", engine.Name, strings.Join(unsupportedChecks, ", "))
+		if finalStatus == "SUCCESS" {
+			finalMessage = fmt.Sprintf("Backup %s validated. %s", backup.ID, msg)
+		} else {
+			finalMessage += " " + msg
+		}
+		finalStatus = "WARNING"
+	}
+
 	// 9. Finish
 	logPrint("Process Completed with status: %s", finalStatus)
-	job.MarkFinished(finalStatus, logs.String())
 	job.LastProcessedBackupID = backup.ID
-	w.QueueService.UpdateJob(job) // Update tabel jobs
+	finishJob(finalStatus, finalMessage) // Update tabel jobs + notifikasi
 
 	// FIXED: Update tabel Parent (RestoreTestConfig) agar ID muncul di list view
-	if finalStatus == "SUCCESS" {
+	if finalStatus == "SUCCESS" || finalStatus == "WARNING" {
 		if job.RestoreTestConfigID != nil {
 			if err := database.DB.Model(&models.RestoreTestConfig{}).
 				Where("id = ?", job.RestoreTestConfigID).
@@ -267,6 +796,63 @@ func (w *Worker) processJob(job *models.Job) {
 			}
 		}
 	}
-	
-	sendNotification(finalStatus == "SUCCESS", finalMessage)
+}
+
+// sendJobNotification mengirim notifikasi status job ke semua channel test. Dipakai worker dan Reaper
+// (job yang ditinggal worker di attempt terakhir). logf mencatat progress per channel.
+func sendJobNotification(config models.RestoreTestConfig, status string, message string, logf func(format string, a ...interface{})) error {
+	var notifs []models.NotificationConfig
+	notificationIDs := []string(config.NotificationIDs)
+	var sendErr error
+
+	if len(notificationIDs) > 0 {
+		if err := database.DB.Where("id IN ?", notificationIDs).Find(&notifs).Error; err != nil {
+			logf("ERROR: Failed to fetch notification configs: %v", err)
+			return err
+		}
+		
+		fullMsg := fmt.Sprintf("[%s] Restore Test: %s\n\n%s", status, config.Name, message)
+
+		for _, n := range notifs {
+			logf("Sending notification to %s (%s)...", n.Name, n.Type)
+			cfg := n.Config
+			
+			var err error
+			if n.Type == "TELEGRAM" {
+				token, _ := cfg["bot_token"].(string)
+				chatID, _ := cfg["chat_id"].(string)
+				err = utils.SendTelegram(token, chatID, fullMsg)
+			} else if n.Type == "EMAIL" {
+				host, _ := cfg["host"].(string)
+				portStr := fmt.Sprintf("%v", cfg["port"])
+				port := 587
+				fmt.Sscanf(portStr, "%d", &port)
+				
+				err = utils.SendEmail(
+					host, port,
+					cfg["user"].(string), cfg["password"].(string),
+					cfg["from_email"].(string), cfg["to_email"].(string),
+					fmt.Sprintf("Databasus Checker: %s", status),
+					fullMsg,
+				)
+			}
+			if err != nil {
+				logf("WARN: Notification to %s failed: %v", n.Name, err)
+				sendErr = err
+			}
+		}
+	}
+	return sendErr
+}
+
+// formatQueryResult baris log untuk result set script: header kolom lalu isi baris (maksimal yang tersimpan)
+func formatQueryResult(result *models.QueryResult) []string {
+	lines := []string{strings.Join(result.Columns, " | ")}
+	for _, row := range result.Rows {
+		lines = append(lines, strings.Join(row, " | "))
+	}
+	if result.Truncated {
+		lines = append(lines, fmt.Sprintf("... (%d rows total)", result.RowCount))
+	}
+	return lines
 }